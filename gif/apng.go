@@ -0,0 +1,161 @@
+package gif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// APNG dispose and blend ops.
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngBlendOver         = 1
+)
+
+// encodeAPNG writes the animation as an APNG. Each frame is encoded as a
+// PNG of its own and its image data moved into the animation, so every
+// frame has to share the first frame's palette.
+func (a *Animation) encodeAPNG(w io.Writer) error {
+	if len(a.Frames) == 0 {
+		return errors.New("apng: no frames")
+	}
+	if a.Frames[0].Image.Rect != image.Rect(0, 0, a.Width, a.Height) {
+		return errors.New("apng: first frame does not cover the canvas")
+	}
+	palette := a.Frames[0].Image.Palette
+
+	data := make([][]byte, len(a.Frames))
+	var header []pngChunk
+	errs := make([]error, len(a.Frames))
+	parallelFor(len(a.Frames), func(i int) {
+		img := a.Frames[i].Image
+		if !samePalette(img.Palette, palette) {
+			errs[i] = errors.New("apng: frames have different palettes")
+			return
+		}
+		chunks, err := encodePNGChunks(img)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		for _, c := range chunks {
+			switch c.typ {
+			case "IDAT":
+				data[i] = append(data[i], c.data...)
+			case "IHDR", "PLTE", "tRNS":
+				if i == 0 {
+					header = append(header, c)
+				}
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	writePNGChunk(&buf, header[0]) // IHDR
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(a.Frames)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(a.Plays))
+	writePNGChunk(&buf, pngChunk{"acTL", actl})
+
+	for _, c := range header[1:] {
+		writePNGChunk(&buf, c)
+	}
+
+	seq := uint32(0)
+	for i, f := range a.Frames {
+		r := f.Image.Rect
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(r.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(r.Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(r.Min.X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(r.Min.Y))
+		binary.BigEndian.PutUint16(fctl[20:], uint16(f.Delay))
+		binary.BigEndian.PutUint16(fctl[22:], 100)
+		fctl[24] = apngDisposeNone
+		if f.Clear {
+			fctl[24] = apngDisposeBackground
+		}
+		fctl[25] = apngBlendOver
+		writePNGChunk(&buf, pngChunk{"fcTL", fctl})
+		seq++
+
+		if i == 0 {
+			writePNGChunk(&buf, pngChunk{"IDAT", data[i]})
+			continue
+		}
+		fdat := make([]byte, 4, 4+len(data[i]))
+		binary.BigEndian.PutUint32(fdat, seq)
+		writePNGChunk(&buf, pngChunk{"fdAT", append(fdat, data[i]...)})
+		seq++
+	}
+	writePNGChunk(&buf, pngChunk{"IEND", nil})
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// encodePNGChunks encodes img as a PNG and splits it into its chunks.
+func encodePNGChunks(img *image.Paletted) ([]pngChunk, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()[len(pngSignature):]
+	var chunks []pngChunk
+	for len(b) >= 12 {
+		n := int(binary.BigEndian.Uint32(b))
+		if 12+n > len(b) {
+			return nil, errors.New("apng: truncated PNG chunk")
+		}
+		chunks = append(chunks, pngChunk{string(b[4:8]), b[8 : 8+n]})
+		b = b[12+n:]
+	}
+	return chunks, nil
+}
+
+func writePNGChunk(buf *bytes.Buffer, c pngChunk) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(c.data)))
+	buf.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(c.typ))
+	crc.Write(c.data)
+	buf.WriteString(c.typ)
+	buf.Write(c.data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	buf.Write(n[:])
+}
+
+func samePalette(a, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 0 || &a[0] == &b[0] {
+		return true
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package gif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+// playAPNG decodes each frame of an APNG as a PNG of its own and composites
+// it as the fcTL chunk says. It fails the test if acTL does not come before
+// the image data.
+func playAPNG(t *testing.T, data []byte) []shownFrame {
+	t.Helper()
+	if !bytes.HasPrefix(data, pngSignature) {
+		t.Fatal("missing PNG signature")
+	}
+	type apngFrame struct {
+		rect           image.Rectangle
+		delay          int
+		dispose, blend byte
+		data           []byte
+	}
+	var (
+		ihdr, plte, trns []byte
+		frames           []apngFrame
+		actl, idat       bool
+		width, height    int
+		numFrames        int
+	)
+	for b := data[len(pngSignature):]; len(b) >= 12; {
+		n := int(binary.BigEndian.Uint32(b))
+		typ, body := string(b[4:8]), b[8:8+n]
+		b = b[12+n:]
+		switch typ {
+		case "IHDR":
+			ihdr = body
+			width, height = int(binary.BigEndian.Uint32(body)), int(binary.BigEndian.Uint32(body[4:]))
+		case "acTL":
+			if idat || frames != nil {
+				t.Fatal("acTL after the image data")
+			}
+			actl = true
+			numFrames = int(binary.BigEndian.Uint32(body))
+		case "PLTE":
+			plte = body
+		case "tRNS":
+			trns = body
+		case "fcTL":
+			x, y := int(binary.BigEndian.Uint32(body[12:])), int(binary.BigEndian.Uint32(body[16:]))
+			w, h := int(binary.BigEndian.Uint32(body[4:])), int(binary.BigEndian.Uint32(body[8:]))
+			num, den := int(binary.BigEndian.Uint16(body[20:])), int(binary.BigEndian.Uint16(body[22:]))
+			frames = append(frames, apngFrame{
+				rect:    image.Rect(x, y, x+w, y+h),
+				delay:   num * 100 / den,
+				dispose: body[24],
+				blend:   body[25],
+			})
+		case "IDAT":
+			idat = true
+			frames[len(frames)-1].data = append(frames[len(frames)-1].data, body...)
+		case "fdAT":
+			frames[len(frames)-1].data = append(frames[len(frames)-1].data, body[4:]...)
+		}
+	}
+	if !actl {
+		t.Fatal("no acTL chunk")
+	}
+	if numFrames != len(frames) {
+		t.Fatalf("acTL counts %d frames, found %d", numFrames, len(frames))
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var shown []shownFrame
+	for i, f := range frames {
+		var buf bytes.Buffer
+		buf.Write(pngSignature)
+		header := bytes.Clone(ihdr)
+		binary.BigEndian.PutUint32(header, uint32(f.rect.Dx()))
+		binary.BigEndian.PutUint32(header[4:], uint32(f.rect.Dy()))
+		writePNGChunk(&buf, pngChunk{"IHDR", header})
+		writePNGChunk(&buf, pngChunk{"PLTE", plte})
+		if trns != nil {
+			writePNGChunk(&buf, pngChunk{"tRNS", trns})
+		}
+		writePNGChunk(&buf, pngChunk{"IDAT", f.data})
+		writePNGChunk(&buf, pngChunk{"IEND", nil})
+		img, err := png.Decode(&buf)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+
+		op := draw.Src
+		if f.blend == apngBlendOver {
+			op = draw.Over
+		}
+		draw.Draw(canvas, f.rect, img, image.Point{}, op)
+		snapshot := image.NewNRGBA(canvas.Rect)
+		copy(snapshot.Pix, canvas.Pix)
+		shown = append(shown, shownFrame{snapshot, f.delay})
+		if f.dispose == apngDisposeBackground {
+			draw.Draw(canvas, f.rect, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return shown
+}
+
+func TestAPNGRoundTrip(t *testing.T) {
+	for name, a := range map[string]*Animation{
+		"frames":   testAnimation(),
+		"rendered": renderedAnimation(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := a.Encode(&buf, FormatAPNG); err != nil {
+				t.Fatal(err)
+			}
+			// Every frame is kept, even ones that change nothing
+			compareFrames(t, playAPNG(t, buf.Bytes()), play(a))
+
+			// Clients without APNG support show the first frame
+			img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameImage(img, a.Frames[0].Image) {
+				t.Error("default image differs from the first frame")
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package gif
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/fogleman/gg"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/sync/singleflight"
+)
+
+// Gradient types.
+const (
+	GradientLinear = "linear"
+	GradientRadial = "radial" // from the center out to the corners
+)
+
+// Fit modes for a background image.
+const (
+	FitCover   = "cover"   // scale to fill the timer, cropping the overflow; the default
+	FitContain = "contain" // scale to fit inside the timer, centered
+	FitTile    = "tile"    // repeat at the image's own size
+)
+
+const maxGradientStops = 16
+
+// Gradient is a background gradient. The zero value means none.
+type Gradient struct {
+	Type  string  // GradientLinear or GradientRadial
+	Angle float64 // direction of a linear gradient in degrees: 0 runs left to right, 90 top to bottom
+	Stops []GradientStop
+}
+
+// GradientStop is a color at Offset (0 … 1) along a gradient.
+type GradientStop struct {
+	Offset float64
+	Color  color.Color
+}
+
+// ValidFit reports whether name is a supported fit mode. The empty string is
+// valid and means cover.
+func ValidFit(name string) bool {
+	switch name {
+	case "", FitCover, FitContain, FitTile:
+		return true
+	}
+	return false
+}
+
+// Validate reports what, if anything, is wrong with g. The zero Gradient is
+// valid.
+func (g Gradient) Validate() error {
+	if g.Type == "" && len(g.Stops) == 0 {
+		return nil
+	}
+	if g.Type != GradientLinear && g.Type != GradientRadial {
+		return fmt.Errorf("gradient type must be %q or %q", GradientLinear, GradientRadial)
+	}
+	if len(g.Stops) < 2 || len(g.Stops) > maxGradientStops {
+		return fmt.Errorf("gradient needs 2 to %d stops", maxGradientStops)
+	}
+	for _, s := range g.Stops {
+		if s.Color == nil {
+			return errors.New("gradient stop is missing a color")
+		}
+		if s.Offset < 0 || s.Offset > 1 {
+			return errors.New("gradient stop offsets must be between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// DefaultImageCacheBytes bounds the decoded background images held in
+// memory until SetImageCacheBytes is called.
+const DefaultImageCacheBytes = 256 << 20
+
+// imageLRU holds decoded background images, least recently used at the back
+// of ll, within a byte budget. Concurrent misses for the same ID share a
+// single load.
+type imageLRU struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+	group    singleflight.Group
+
+	// loader fetches background image files by ID.
+	loader func(id string) ([]byte, error)
+}
+
+type imageEntry struct {
+	id    string
+	img   image.Image
+	bytes int64
+}
+
+var bgImages = newImageLRU(DefaultImageCacheBytes)
+
+func newImageLRU(maxBytes int64) *imageLRU {
+	return &imageLRU{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// SetImageLoader registers how background images named by templates are
+// fetched.
+func SetImageLoader(loader func(id string) ([]byte, error)) {
+	bgImages.mu.Lock()
+	bgImages.loader = loader
+	bgImages.mu.Unlock()
+}
+
+// SetImageCacheBytes changes how many bytes of decoded background images
+// are kept, evicting images as needed. Zero means no limit.
+func SetImageCacheBytes(maxBytes int64) {
+	bgImages.mu.Lock()
+	bgImages.maxBytes = maxBytes
+	bgImages.prune()
+	bgImages.mu.Unlock()
+}
+
+// ForgetImage drops a decoded background image, along with the sprites drawn
+// over it, e.g. after its upload was deleted.
+func ForgetImage(id string) {
+	bgImages.mu.Lock()
+	if el, ok := bgImages.items[id]; ok {
+		bgImages.remove(el)
+	}
+	bgImages.mu.Unlock()
+	spriteCaches.forget(func(k cacheKey) bool { return k.BackgroundImage == id })
+}
+
+// getImage returns the decoded background image for id, loading it on first
+// use.
+func getImage(id string) (image.Image, error) {
+	return bgImages.get(id)
+}
+
+func (c *imageLRU) get(id string) (image.Image, error) {
+	c.mu.Lock()
+	if el, ok := c.items[id]; ok {
+		c.ll.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*imageEntry).img, nil
+	}
+	loader := c.loader
+	c.mu.Unlock()
+	if loader == nil {
+		return nil, errors.New("no image loader registered")
+	}
+
+	v, err, _ := c.group.Do(id, func() (interface{}, error) {
+		data, err := loader(id)
+		if err != nil {
+			return nil, err
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if el, ok := c.items[id]; ok {
+			c.remove(el)
+		}
+		e := &imageEntry{id: id, img: img, bytes: decodedBytes(img)}
+		c.items[id] = c.ll.PushFront(e)
+		c.size += e.bytes
+		c.prune()
+		c.mu.Unlock()
+		return img, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(image.Image), nil
+}
+
+// prune drops least recently used images until the cache is within its
+// budget. The most recent image is always kept. Callers hold c.mu.
+func (c *imageLRU) prune() {
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.ll.Len() > 1 {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *imageLRU) remove(el *list.Element) {
+	e := el.Value.(*imageEntry)
+	c.ll.Remove(el)
+	delete(c.items, e.id)
+	c.size -= e.bytes
+}
+
+// decodedBytes estimates the memory a decoded image holds, at four bytes a
+// pixel.
+func decodedBytes(img image.Image) int64 {
+	b := img.Bounds()
+	return int64(b.Dx()) * int64(b.Dy()) * 4
+}
+
+// textured reports whether the timer sits on a gradient or image rather than
+// a flat color. Transparent timers have no background to draw.
+func (c Config) textured() bool {
+	return !c.Transparent && (c.Gradient.Type != "" || c.BackgroundImage != "")
+}
+
+// backdrop renders the background at the timer's size: the background
+// color, the gradient over it, then the image. An image that cannot be
+// loaded is left out rather than failing the render.
+func (c Config) backdrop() *image.RGBA {
+	w, h := float64(c.Width), float64(c.Height)
+	dc := gg.NewContext(c.Width, c.Height)
+	dc.SetColor(c.Background)
+	dc.Clear()
+
+	if c.Gradient.Type != "" {
+		var grad gg.Gradient
+		if c.Gradient.Type == GradientRadial {
+			grad = gg.NewRadialGradient(w/2, h/2, 0, w/2, h/2, math.Hypot(w, h)/2)
+		} else {
+			// Run the gradient through the center, long enough that
+			// its ends touch the corners
+			rad := c.Gradient.Angle * math.Pi / 180
+			dx, dy := math.Cos(rad), math.Sin(rad)
+			half := math.Abs(w/2*dx) + math.Abs(h/2*dy)
+			grad = gg.NewLinearGradient(w/2-dx*half, h/2-dy*half, w/2+dx*half, h/2+dy*half)
+		}
+		for _, s := range c.Gradient.Stops {
+			grad.AddColorStop(s.Offset, s.Color)
+		}
+		dc.SetFillStyle(grad)
+		dc.DrawRectangle(0, 0, w, h)
+		dc.Fill()
+	}
+
+	dst := dc.Image().(*image.RGBA)
+	if c.BackgroundImage != "" {
+		img, err := getImage(c.BackgroundImage)
+		if err != nil {
+			log.Printf("Background image %s not drawn: %v", c.BackgroundImage, err)
+			return dst
+		}
+		drawFitted(dst, img, c.BackgroundFit)
+	}
+	return dst
+}
+
+// drawFitted draws img over dst as the fit mode says.
+func drawFitted(dst *image.RGBA, img image.Image, fit string) {
+	b := img.Bounds()
+	if b.Empty() {
+		return
+	}
+
+	if fit == FitTile {
+		for y := 0; y < dst.Rect.Dy(); y += b.Dy() {
+			for x := 0; x < dst.Rect.Dx(); x += b.Dx() {
+				draw.Draw(dst, b.Sub(b.Min).Add(image.Pt(x, y)), img, b.Min, draw.Over)
+			}
+		}
+		return
+	}
+
+	sx := float64(dst.Rect.Dx()) / float64(b.Dx())
+	sy := float64(dst.Rect.Dy()) / float64(b.Dy())
+	scale := math.Max(sx, sy)
+	if fit == FitContain {
+		scale = math.Min(sx, sy)
+	}
+	w := int(math.Round(float64(b.Dx()) * scale))
+	h := int(math.Round(float64(b.Dy()) * scale))
+	x := (dst.Rect.Dx() - w) / 2
+	y := (dst.Rect.Dy() - h) / 2
+	xdraw.CatmullRom.Scale(dst, image.Rect(x, y, x+w, y+h), img, b, draw.Over, nil)
+}
@@ -0,0 +1,34 @@
+package gif
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestImageLRUEvictsOverBudget(t *testing.T) {
+	var file bytes.Buffer
+	if err := png.Encode(&file, image.NewGray(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	loads := 0
+	c := newImageLRU(2 * 16 * 16 * 4)
+	c.loader = func(id string) ([]byte, error) {
+		loads++
+		return file.Bytes(), nil
+	}
+
+	for _, id := range []string{"a", "b", "a", "c", "a", "b"} {
+		if _, err := c.get(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a stays in use throughout; b is evicted by c, then reloaded
+	if loads != 4 {
+		t.Errorf("%d loads, want 4", loads)
+	}
+	if c.ll.Len() != 2 || c.size != c.maxBytes {
+		t.Errorf("%d images in %d bytes, want 2 in %d", c.ll.Len(), c.size, c.maxBytes)
+	}
+}
@@ -0,0 +1,257 @@
+package gif
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"time"
+)
+
+const (
+	defaultMinDigits = 2
+	maxMinDigits     = 9
+)
+
+// frameCounts are the frame counts a countdown can be rendered with; more
+// frames cover more time but make a bigger GIF.
+var frameCounts = []int{10, 30, 60, 120}
+
+const (
+	defaultFrames     = 60
+	defaultFrameDelay = 100 // hundredths of a second
+
+	// Bounds on the frame delay. Browsers slow shorter delays down anyway.
+	minFrameDelay = 10
+	maxFrameDelay = 1000
+)
+
+// Loop behaviors.
+const (
+	LoopForever = "forever" // the default
+	LoopOnce    = "once"    // play through once and stop on the last frame
+)
+
+// ValidFrameCount reports whether n is zero (the default) or one of the
+// supported frame counts.
+func ValidFrameCount(n int) bool {
+	if n == 0 {
+		return true
+	}
+	for _, c := range frameCounts {
+		if n == c {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidFrameDelay reports whether d, in hundredths of a second, is zero
+// (the default) or within the supported range.
+func ValidFrameDelay(d int) bool {
+	return d == 0 || (d >= minFrameDelay && d <= maxFrameDelay)
+}
+
+// ValidLoop reports whether name is a supported loop behavior. The empty
+// string is valid and means forever.
+func ValidLoop(name string) bool {
+	switch name {
+	case "", LoopForever, LoopOnce:
+		return true
+	}
+	return false
+}
+
+// minDigits returns how many digits a unit is zero-padded to.
+func (c Config) minDigits(unit int) int {
+	switch n := c.MinDigits[unit]; {
+	case n <= 0:
+		return defaultMinDigits
+	case n > maxMinDigits:
+		return maxMinDigits
+	default:
+		return n
+	}
+}
+
+// frameCount returns how many frames the countdown animation has.
+func (c Config) frameCount() int {
+	if c.Expired {
+		return 1
+	}
+	if ValidFrameCount(c.Frames) && c.Frames > 0 {
+		return c.Frames
+	}
+	return defaultFrames
+}
+
+// frameDelay returns how long each frame is shown, in hundredths of a
+// second. Frames are that far apart in time, so the countdown runs in step
+// with the clock.
+func (c Config) frameDelay() int {
+	if ValidFrameDelay(c.FrameDelay) && c.FrameDelay > 0 {
+		return c.FrameDelay
+	}
+	return defaultFrameDelay
+}
+
+// plays returns how many times the animation plays; 0 loops forever.
+func (c Config) plays() int {
+	if c.Loop == LoopOnce {
+		return 1
+	}
+	return 0
+}
+
+// startTime returns the instant shown by the first frame.
+func (c Config) startTime() time.Time {
+	if c.Now.IsZero() {
+		return time.Now()
+	}
+	return c.Now
+}
+
+// frameValues returns the days, hours, minutes and seconds shown by each of
+// frames frames starting at now.
+func (c Config) frameValues(now time.Time, frames int) [][4]int {
+	step := time.Duration(c.frameDelay()) * 10 * time.Millisecond
+	values := make([][4]int, frames)
+	for i := range values {
+		if c.Expired {
+			// All zeros for expired state
+			continue
+		}
+		remaining := c.EndTime.Sub(now) - time.Duration(i)*step
+		days, hours, minutes, seconds := splitDuration(remaining)
+		values[i] = [4]int{days, hours, minutes, seconds}
+	}
+	return values
+}
+
+// columnDigits returns how many digits wide each enabled column has to be
+// to show every one of values.
+func (c Config) columnDigits(values [][4]int) []int {
+	cols := c.enabledColumns()
+	digits := make([]int, len(cols))
+	for col, unit := range cols {
+		digits[col] = c.minDigits(unit)
+		for _, vals := range values {
+			if n := len(fmt.Sprint(vals[unit])); n > digits[col] {
+				digits[col] = n
+			}
+		}
+	}
+	return digits
+}
+
+type numberKey struct {
+	text   string
+	slots  int
+	align  float64
+	origin image.Point
+}
+
+// valueSprite returns the sprite for v, zero-padded to minDigits and placed
+// in a column slots digits wide: centered for align 0.5, right-aligned for
+// 1. Over a backdrop the sprite also depends on its origin in the frame.
+// Sprites are composed from the cached glyphs on first use.
+func (c *spriteCache) valueSprite(v, minDigits, slots int, align float64, origin image.Point) *image.Paletted {
+	if c.backdrop == nil {
+		origin = image.Point{}
+	}
+	key := numberKey{text: fmt.Sprintf("%0*d", minDigits, v), slots: slots, align: align, origin: origin}
+	if sprite, ok := c.numbers.Load(key); ok {
+		return sprite.(*image.Paletted)
+	}
+	composed := c.composeNumber(key)
+	sprite := c.remember(&c.numbers, key, composed, len(composed.Pix)).(*image.Paletted)
+	if sprite == composed && c.backdrop != nil {
+		c.remember(&c.spriteKeys, composed, key, 0)
+	}
+	return sprite
+}
+
+// composeNumber lays the number out glyph by glyph, with each glyph's own
+// advance and the font's kerning between pairs.
+func (c *spriteCache) composeNumber(key numberKey) *image.Paletted {
+	if c.backdrop != nil {
+		mask := c.numberMask(key)
+		return c.inkOverBackdrop(mask, mask.Rect, key.origin)
+	}
+
+	dst := image.NewPaletted(image.Rect(0, 0, c.spriteWidth(key.slots), c.spriteH), c.quant.palette)
+	for i := range dst.Pix {
+		dst.Pix[i] = c.bg
+	}
+	for i, x := range c.glyphOffsets(key.text, key.slots, key.align) {
+		stampGlyph(dst, c.glyphs[rune(key.text[i])].img, x, c.bg)
+	}
+	return dst
+}
+
+// numberMask returns the glyph coverage of a number's sprite.
+func (c *spriteCache) numberMask(key numberKey) *image.Alpha {
+	mask := image.NewAlpha(image.Rect(0, 0, c.spriteWidth(key.slots), c.spriteH))
+	for i, x := range c.glyphOffsets(key.text, key.slots, key.align) {
+		g := c.glyphs[rune(key.text[i])].mask
+		draw.DrawMask(mask, g.Rect.Add(image.Pt(x, 0)), image.Opaque, image.Point{}, g, image.Point{}, draw.Over)
+	}
+	return mask
+}
+
+// inkOverBackdrop paints the text color through the r part of mask over the
+// backdrop at origin, and quantizes the result.
+func (c *spriteCache) inkOverBackdrop(mask *image.Alpha, r image.Rectangle, origin image.Point) *image.Paletted {
+	rgba := image.NewRGBA(r)
+	draw.Draw(rgba, r, c.backdrop, origin.Add(r.Min), draw.Src)
+	draw.DrawMask(rgba, r, image.NewUniform(c.ink), image.Point{}, mask, r.Min, draw.Over)
+	return c.quant.quantize(rgba, r)
+}
+
+// glyphOffsets returns where the left edge of each glyph of text goes.
+func (c *spriteCache) glyphOffsets(text string, slots int, align float64) []int {
+	width := 0.0
+	var prev rune
+	for i, r := range text {
+		if i > 0 {
+			width += c.kerning[[2]rune{prev, r}]
+		}
+		width += c.glyphs[r].advance
+		prev = r
+	}
+
+	offsets := make([]int, 0, len(text))
+	x := spritePad + (c.slotW*float64(slots)-width)*align
+	for i, r := range text {
+		if i > 0 {
+			x += c.kerning[[2]rune{prev, r}]
+		}
+		g := c.glyphs[r]
+		offsets = append(offsets, int(math.Round(x))-g.originX)
+		x += g.advance
+		prev = r
+	}
+	return offsets
+}
+
+// spriteWidth is the width of the sprite for a column slots digits wide.
+func (c *spriteCache) spriteWidth(slots int) int {
+	return int(c.slotW*float64(slots) + spritePad*2)
+}
+
+// stampGlyph copies the non-background pixels of glyph into dst at x, so
+// neighboring digits whose edges overlap keep their ink.
+func stampGlyph(dst, glyph *image.Paletted, x int, bg uint8) {
+	b := glyph.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for gx := b.Min.X; gx < b.Max.X; gx++ {
+			dx := x + gx - b.Min.X
+			if dx < 0 || dx >= dst.Rect.Dx() {
+				continue
+			}
+			if p := glyph.Pix[glyph.PixOffset(gx, y)]; p != bg {
+				dst.Pix[dst.PixOffset(dx, y)] = p
+			}
+		}
+	}
+}
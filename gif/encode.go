@@ -0,0 +1,205 @@
+package gif
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Animation is a rendered countdown, independent of the format it is
+// encoded in. Every frame is drawn over the ones before it, as in a GIF.
+type Animation struct {
+	Width, Height int
+	Frames        []Frame
+	Plays         int         // Times the animation plays; 0 loops forever
+	Matte         color.Color // Shown behind transparent pixels by formats without transparency
+}
+
+// Frame is one frame of an Animation.
+type Frame struct {
+	// Image covers the part of the canvas the frame draws; its transparent
+	// pixels leave what is underneath. The first frame covers the canvas.
+	Image *image.Paletted
+	Delay int  // Hundredths of a second
+	Clear bool // Clear Image's bounds to transparent once the frame is shown
+}
+
+// Format is an encoding for an Animation.
+type Format string
+
+const (
+	FormatGIF  Format = "gif"
+	FormatAPNG Format = "apng"
+	FormatWebP Format = "webp"
+
+	// Still formats, holding the first frame only
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+)
+
+// jpegQuality is the quality JPEG snapshots are encoded at.
+const jpegQuality = 90
+
+// ParseFormat returns the format named by s, as used in a ?format= query.
+// The empty string is GIF.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case "":
+		return FormatGIF, nil
+	case "jpg":
+		return FormatJPEG, nil
+	case FormatGIF, FormatAPNG, FormatWebP, FormatPNG, FormatJPEG:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q", s)
+}
+
+// formatTypes are the media types each animated format is negotiated by, in
+// order of preference when a client accepts several equally. Still formats
+// are only served when asked for by name.
+var formatTypes = []struct {
+	mediaType string
+	format    Format
+}{
+	{"image/webp", FormatWebP},
+	{"image/apng", FormatAPNG},
+	{"image/gif", FormatGIF},
+}
+
+// NegotiateFormat picks a format from an Accept header. Only formats the
+// client names explicitly are chosen, since image/* and */* are sent by
+// clients that cannot animate anything but GIFs; without one it is GIF.
+func NegotiateFormat(accept string) Format {
+	best, bestQ := FormatGIF, 0.0
+	for _, ft := range formatTypes {
+		if q := acceptQuality(accept, ft.mediaType); q > bestQ {
+			best, bestQ = ft.format, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q value accept gives mediaType, or 0 if it is
+// not listed.
+func acceptQuality(accept, mediaType string) float64 {
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), mediaType) {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		return q
+	}
+	return 0
+}
+
+// PickFormat returns the format named by param, a ?format= query value, or
+// if that is empty the one negotiated from accept.
+func PickFormat(param, accept string) (Format, error) {
+	if param != "" {
+		return ParseFormat(param)
+	}
+	return NegotiateFormat(accept), nil
+}
+
+// Animated reports whether the format holds every frame, rather than a
+// still of the first.
+func (f Format) Animated() bool {
+	return f != FormatPNG && f != FormatJPEG
+}
+
+// ContentType returns the Content-Type to serve the format with. APNG is
+// served as image/png, which every client accepts; those that cannot
+// animate it show the first frame.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatAPNG, FormatPNG:
+		return "image/png"
+	case FormatWebP:
+		return "image/webp"
+	case FormatJPEG:
+		return "image/jpeg"
+	}
+	return "image/gif"
+}
+
+// Encode writes the animation to w in the given format.
+func (a *Animation) Encode(w io.Writer, format Format) error {
+	switch format {
+	case FormatGIF:
+		return a.encodeGIF(w)
+	case FormatAPNG:
+		return a.encodeAPNG(w)
+	case FormatWebP:
+		return a.encodeWebP(w)
+	case FormatPNG:
+		return png.Encode(w, a.Frames[0].Image)
+	case FormatJPEG:
+		return a.encodeJPEG(w)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// encodeGIF writes the animation as a GIF. Cleared frames are disposed to
+// the background, which GIF decoders treat as transparent.
+func (a *Animation) encodeGIF(w io.Writer) error {
+	anim := gif.GIF{
+		Image:    make([]*image.Paletted, len(a.Frames)),
+		Delay:    make([]int, len(a.Frames)),
+		Disposal: make([]byte, len(a.Frames)),
+	}
+	// A GIF's loop count is how many times it repeats after the first play
+	if a.Plays > 0 {
+		anim.LoopCount = a.Plays - 1
+		if anim.LoopCount == 0 {
+			anim.LoopCount = -1
+		}
+	}
+	for i, f := range a.Frames {
+		anim.Image[i] = f.Image
+		anim.Delay[i] = f.Delay
+		anim.Disposal[i] = gif.DisposalNone
+		if f.Clear {
+			anim.Disposal[i] = gif.DisposalBackground
+		}
+	}
+	return gif.EncodeAll(w, &anim)
+}
+
+// encodeJPEG writes the first frame as a JPEG, over the matte since JPEGs
+// have no transparency.
+func (a *Animation) encodeJPEG(w io.Writer) error {
+	frame := a.Frames[0].Image
+	matte := a.Matte
+	if matte == nil {
+		matte = color.White
+	}
+	flat := image.NewRGBA(frame.Rect)
+	draw.Draw(flat, flat.Rect, image.NewUniform(matte), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Rect, frame, frame.Rect.Min, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: jpegQuality})
+}
+
+// encode returns the animation encoded in format.
+func (a *Animation) encode(format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := a.Encode(&buf, format); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,137 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+// shownFrame is the canvas as displayed after a frame, and for how long.
+type shownFrame struct {
+	img   *image.NRGBA
+	delay int // hundredths of a second
+}
+
+// testAnimation has frames at odd offsets, transparent pixels and a frame
+// that clears itself, over an odd-sized canvas.
+func testAnimation() *Animation {
+	palette := color.Palette{
+		color.Transparent,
+		color.RGBA{R: 200, A: 255},
+		color.RGBA{G: 150, A: 255},
+		color.RGBA{B: 100, A: 255},
+	}
+	frame := func(r image.Rectangle, fill func(x, y int) uint8) *image.Paletted {
+		img := image.NewPaletted(r, palette)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetColorIndex(x, y, fill(x, y))
+			}
+		}
+		return img
+	}
+	return &Animation{
+		Width:  11,
+		Height: 7,
+		Plays:  2,
+		Frames: []Frame{
+			{Image: frame(image.Rect(0, 0, 11, 7), func(x, y int) uint8 { return uint8(1 + (x+y)%3/2*2) }), Delay: 100},
+			{Image: frame(image.Rect(3, 1, 6, 4), func(x, y int) uint8 { return uint8(2 * (x % 2)) }), Delay: 50},
+			{Image: frame(image.Rect(1, 3, 4, 6), func(x, y int) uint8 { return 3 }), Delay: 25, Clear: true},
+			{Image: frame(image.Rect(7, 5, 9, 7), func(x, y int) uint8 { return 2 }), Delay: 7},
+		},
+	}
+}
+
+// renderedAnimation is a real countdown.
+func renderedAnimation(t *testing.T) *Animation {
+	t.Helper()
+	cfg := benchmarkConfig(24)
+	cfg.Now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.EndTime = cfg.Now.Add(time.Hour + 5*time.Second)
+	cfg.Frames = 10
+	a, err := Render(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// play shows the animation's frames as a GIF decoder would.
+func play(a *Animation) []shownFrame {
+	canvas := image.NewNRGBA(image.Rect(0, 0, a.Width, a.Height))
+	var shown []shownFrame
+	for _, f := range a.Frames {
+		r := f.Image.Rect
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if c := f.Image.At(x, y); !isTransparent(c) {
+					canvas.Set(x, y, c)
+				}
+			}
+		}
+		img := image.NewNRGBA(canvas.Rect)
+		copy(img.Pix, canvas.Pix)
+		shown = append(shown, shownFrame{img, f.Delay})
+		if f.Clear {
+			draw.Draw(canvas, r, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return shown
+}
+
+// merge joins consecutive identical frames, as encoders may.
+func merge(frames []shownFrame) []shownFrame {
+	var merged []shownFrame
+	for _, f := range frames {
+		if n := len(merged); n > 0 && sameImage(merged[n-1].img, f.img) {
+			merged[n-1].delay += f.delay
+			continue
+		}
+		merged = append(merged, f)
+	}
+	return merged
+}
+
+func isTransparent(c color.Color) bool {
+	_, _, _, a := c.RGBA()
+	return a == 0
+}
+
+// sameImage compares two images pixel by pixel, treating every transparent
+// color as the same.
+func sameImage(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ca := color.NRGBAModel.Convert(a.At(x, y)).(color.NRGBA)
+			cb := color.NRGBAModel.Convert(b.At(x, y)).(color.NRGBA)
+			if ca != cb && (ca.A != 0 || cb.A != 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compareFrames checks frames decoded from an encoding against the ones
+// played back from the animation.
+func compareFrames(t *testing.T, got, want []shownFrame) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d frames, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].delay != want[i].delay {
+			t.Errorf("frame %d: delay %d, want %d", i, got[i].delay, want[i].delay)
+		}
+		if !sameImage(got[i].img, want[i].img) {
+			t.Errorf("frame %d: pixels differ", i)
+		}
+	}
+}
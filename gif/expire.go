@@ -0,0 +1,26 @@
+package gif
+
+import "time"
+
+// What a countdown shows once its end time has passed.
+const (
+	ExpireShowZeros  = "show_zeros"  // a single frame of zeros, the default
+	ExpireHide       = "hide"        // a 1x1 transparent image
+	ExpireCustomText = "custom_text" // ExpireText centered on the background
+)
+
+// ValidExpireBehavior reports whether name is a supported expire behavior.
+// The empty string is valid and means show_zeros.
+func ValidExpireBehavior(name string) bool {
+	switch name {
+	case "", ExpireShowZeros, ExpireHide, ExpireCustomText:
+		return true
+	}
+	return false
+}
+
+// expiredAt reports whether the countdown is over at now: it was marked
+// Expired, or its end time has been reached.
+func (c Config) expiredAt(now time.Time) bool {
+	return c.Expired || (!c.EndTime.IsZero() && !c.EndTime.After(now))
+}
@@ -1,39 +1,178 @@
 package gif
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
 )
 
+// maxUnknownFonts bounds unknownFonts, which is cleared when full.
+const maxUnknownFonts = 4096
+
+// ErrUnknownFont is returned by font loaders for names they do not know.
+var ErrUnknownFont = errors.New("unknown font")
+
 var (
 	fontRegistry   = make(map[string]*truetype.Font)
 	fontRegistryMu sync.RWMutex
 	fallbackFont   *truetype.Font
+
+	// fontLoader fetches font files that are neither bundled nor cached,
+	// such as user uploads referenced by font ID.
+	fontLoader func(name string) ([]byte, error)
+
+	// unknownFonts are names the loader does not know, so templates naming
+	// a deleted font don't reach it on every render.
+	unknownFonts = make(map[string]struct{})
+
+	// catalog is the parsed fonts/manifest.json; catalogFiles maps each
+	// lowercased face name to its font file path.
+	catalog      fontManifest
+	catalogFiles = make(map[string]string)
+
+	catalogInfo     []FontFamilyInfo
+	catalogInfoOnce sync.Once
 )
 
-// fontFileMap maps frontend font names to local font file paths.
-// For now only Arial is available; more fonts can be added later.
-var fontFileMap = map[string]string{
-	"Arial": "fonts/Arial.ttf",
+type fontManifest struct {
+	Default   string            `json:"default"`
+	Fallbacks map[string]string `json:"fallbacks"` // category → family
+	Families  []manifestFamily  `json:"families"`
+}
+
+type manifestFamily struct {
+	Name     string         `json:"name"`
+	Category string         `json:"category"`
+	License  string         `json:"license"`
+	Faces    []manifestFace `json:"faces"`
+}
+
+type manifestFace struct {
+	Weight int    `json:"weight"`
+	Style  string `json:"style"`
+	File   string `json:"file"`
+}
+
+// name is the face's lookup name, e.g. "DejaVu Sans Bold". Regular faces
+// are also reachable by the bare family name, which is what Catalog lists.
+func (f manifestFace) name(family string) string {
+	return family + " " + f.Style
 }
 
-func initFontRegistry() {
-	fontBytes, err := os.ReadFile("fonts/Arial.ttf")
+func (f manifestFace) displayName(family string) string {
+	if f.Style == "Regular" {
+		return family
+	}
+	return f.name(family)
+}
+
+// FontFamilyInfo describes a bundled font family for the fonts API.
+type FontFamilyInfo struct {
+	Name     string         `json:"name"`
+	Category string         `json:"category"`
+	License  string         `json:"license"`
+	Faces    []FontFaceInfo `json:"faces"`
+}
+
+type FontFaceInfo struct {
+	Name    string      `json:"name"`
+	Weight  int         `json:"weight"`
+	Style   string      `json:"style"`
+	Metrics FontMetrics `json:"metrics"`
+}
+
+// FontMetrics are measured at SampleSize pixels, so clients can compare
+// how large digits render across families.
+type FontMetrics struct {
+	SampleSize float64 `json:"sample_size"`
+	Ascent     float64 `json:"ascent"`
+	Descent    float64 `json:"descent"`
+	LineHeight float64 `json:"line_height"`
+	DigitWidth float64 `json:"digit_width"` // advance of "00"
+}
+
+const fontSampleSize = 100
+
+// LoadFonts registers the bundled fonts listed in dir/manifest.json. It has
+// to be called before anything is rendered.
+func LoadFonts(dir string) error {
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
 	if err != nil {
-		panic(fmt.Sprintf("failed to read fallback font: %v", err))
+		return fmt.Errorf("failed to read font manifest: %w", err)
+	}
+	if err := json.Unmarshal(manifestBytes, &catalog); err != nil {
+		return fmt.Errorf("failed to parse font manifest: %w", err)
+	}
+
+	for _, family := range catalog.Families {
+		for i, face := range family.Faces {
+			path := filepath.Join(dir, face.File)
+			catalogFiles[strings.ToLower(face.name(family.Name))] = path
+			if face.Style == "Regular" || (i == 0 && !hasRegularFace(family)) {
+				catalogFiles[strings.ToLower(family.Name)] = path
+			}
+		}
+	}
+
+	path, ok := catalogFiles[strings.ToLower(catalog.Default)]
+	if !ok {
+		return fmt.Errorf("default font %q is not in the manifest", catalog.Default)
+	}
+	fontBytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read fallback font: %w", err)
 	}
 	f, err := truetype.Parse(fontBytes)
 	if err != nil {
-		panic(fmt.Sprintf("failed to parse fallback font: %v", err))
+		return fmt.Errorf("failed to parse fallback font: %w", err)
 	}
 	fallbackFont = f
-	fontRegistry["Arial"] = f
+	fontRegistry[catalog.Default] = f
+	return nil
+}
+
+func hasRegularFace(family manifestFamily) bool {
+	for _, face := range family.Faces {
+		if face.Style == "Regular" {
+			return true
+		}
+	}
+	return false
 }
 
-// GetFont returns the font for the given name, or the Arial fallback.
+// SetFontLoader registers the function GetFont uses to fetch fonts it does
+// not ship with. It should return ErrUnknownFont for names it does not know,
+// which are then not asked for again.
+func SetFontLoader(loader func(name string) ([]byte, error)) {
+	fontRegistryMu.Lock()
+	fontLoader = loader
+	clear(unknownFonts)
+	fontRegistryMu.Unlock()
+}
+
+// ForgetFont drops a loaded font from the registry, along with the sprites
+// drawn in it, e.g. after its upload was deleted.
+func ForgetFont(name string) {
+	fontRegistryMu.Lock()
+	_, bundled := catalogFiles[strings.ToLower(name)]
+	if !bundled {
+		delete(fontRegistry, name)
+	}
+	fontRegistryMu.Unlock()
+	if !bundled {
+		spriteCaches.forget(func(k cacheKey) bool { return k.NumberFontName == name })
+	}
+}
+
+// GetFont returns the font for the given name: a catalog face, then a font
+// from the registered loader, then the closest catalog fallback.
 func GetFont(name string) *truetype.Font {
 	if name == "" {
 		return fallbackFont
@@ -46,27 +185,167 @@ func GetFont(name string) *truetype.Font {
 	}
 	fontRegistryMu.RUnlock()
 
-	// Try to load from fontFileMap
-	if path, ok := fontFileMap[name]; ok {
+	if f := loadCatalogFont(name); f != nil {
+		return f
+	}
+	if f := loadFont(name); f != nil {
+		return f
+	}
+	if f := loadCatalogFont(fallbackFontName(name)); f != nil {
+		return f
+	}
+	return fallbackFont
+}
+
+// loadCatalogFont loads and caches a bundled face, or returns nil if the
+// name is not in the catalog.
+func loadCatalogFont(name string) *truetype.Font {
+	path, ok := catalogFiles[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+
+	fontRegistryMu.Lock()
+	defer fontRegistryMu.Unlock()
+
+	// Double-check after acquiring write lock
+	if f, ok := fontRegistry[name]; ok {
+		return f
+	}
+
+	fontBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	f, err := truetype.Parse(fontBytes)
+	if err != nil {
+		return nil
+	}
+	fontRegistry[name] = f
+	return f
+}
+
+// loadFont resolves a name through the registered fontLoader, outside the
+// registry lock since the loader may hit the database and object storage.
+func loadFont(name string) *truetype.Font {
+	fontRegistryMu.RLock()
+	loader := fontLoader
+	_, unknown := unknownFonts[name]
+	fontRegistryMu.RUnlock()
+	if loader == nil || unknown {
+		return nil
+	}
+
+	fontBytes, err := loader(name)
+	if errors.Is(err, ErrUnknownFont) {
 		fontRegistryMu.Lock()
-		defer fontRegistryMu.Unlock()
+		if len(unknownFonts) >= maxUnknownFonts {
+			clear(unknownFonts)
+		}
+		unknownFonts[name] = struct{}{}
+		fontRegistryMu.Unlock()
+	}
+	if err != nil {
+		return nil
+	}
+	f, err := truetype.Parse(fontBytes)
+	if err != nil {
+		return nil
+	}
 
-		// Double-check after acquiring write lock
-		if f, ok := fontRegistry[name]; ok {
-			return f
+	fontRegistryMu.Lock()
+	defer fontRegistryMu.Unlock()
+	if existing, ok := fontRegistry[name]; ok {
+		return existing
+	}
+	fontRegistry[name] = f
+	return f
+}
+
+// fallbackFontName picks a catalog face for a font we don't have, guessing
+// the category and weight from its name ("Courier New" → mono,
+// "Georgia Bold" → serif bold).
+func fallbackFontName(name string) string {
+	n := strings.ToLower(name)
+	containsAny := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(n, w) {
+				return true
+			}
 		}
+		return false
+	}
 
-		fontBytes, err := os.ReadFile(path)
-		if err != nil {
-			return fallbackFont
+	category := "sans"
+	switch {
+	case containsAny("mono", "courier", "consol", "code", "typewriter"):
+		category = "mono"
+	case containsAny("condensed", "narrow", "compressed"):
+		category = "condensed"
+	case containsAny("serif") && !containsAny("sans"),
+		containsAny("times", "georgia", "garamond", "baskerville", "roman", "book"):
+		category = "serif"
+	case containsAny("display", "impact", "poster", "caps"):
+		category = "display"
+	}
+
+	family, ok := catalog.Fallbacks[category]
+	if !ok {
+		family = catalog.Default
+	}
+	if containsAny("bold", "black", "heavy") {
+		// Prefer the category fallback's bold face, then any bold face in
+		// the same category.
+		if _, ok := catalogFiles[strings.ToLower(family+" Bold")]; ok {
+			return family + " Bold"
 		}
-		f, err := truetype.Parse(fontBytes)
-		if err != nil {
-			return fallbackFont
+		for _, f := range catalog.Families {
+			if f.Category != category {
+				continue
+			}
+			if _, ok := catalogFiles[strings.ToLower(f.Name+" Bold")]; ok {
+				return f.Name + " Bold"
+			}
 		}
-		fontRegistry[name] = f
-		return f
 	}
+	return family
+}
 
-	return fallbackFont
+// Catalog lists the bundled font families with sample metrics for each
+// face. Faces are parsed on first call.
+func Catalog() []FontFamilyInfo {
+	catalogInfoOnce.Do(func() {
+		for _, family := range catalog.Families {
+			info := FontFamilyInfo{
+				Name:     family.Name,
+				Category: family.Category,
+				License:  family.License,
+			}
+			for _, face := range family.Faces {
+				name := face.displayName(family.Name)
+				info.Faces = append(info.Faces, FontFaceInfo{
+					Name:    name,
+					Weight:  face.Weight,
+					Style:   face.Style,
+					Metrics: measureFont(GetFont(name)),
+				})
+			}
+			catalogInfo = append(catalogInfo, info)
+		}
+	})
+	return catalogInfo
+}
+
+func measureFont(f *truetype.Font) FontMetrics {
+	face := truetype.NewFace(f, &truetype.Options{Size: fontSampleSize})
+	defer face.Close()
+
+	m := face.Metrics()
+	return FontMetrics{
+		SampleSize: fontSampleSize,
+		Ascent:     float64(m.Ascent) / 64,
+		Descent:    float64(m.Descent) / 64,
+		LineHeight: float64(m.Height) / 64,
+		DigitWidth: float64(font.MeasureString(face, "00")) / 64,
+	}
 }
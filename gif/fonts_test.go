@@ -0,0 +1,32 @@
+package gif
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnknownFontsAreNotReloaded(t *testing.T) {
+	calls := map[string]int{}
+	SetFontLoader(func(name string) ([]byte, error) {
+		calls[name]++
+		if name == "broken" {
+			return nil, errors.New("storage unavailable")
+		}
+		return nil, ErrUnknownFont
+	})
+	defer SetFontLoader(nil)
+
+	for i := 0; i < 3; i++ {
+		if GetFont("deleted") != GetFont(catalog.Default) {
+			t.Fatal("unknown font did not fall back to the default")
+		}
+		GetFont("broken")
+	}
+	if calls["deleted"] != 1 {
+		t.Errorf("unknown font loaded %d times, want 1", calls["deleted"])
+	}
+	// Other errors may be transient, so they are retried
+	if calls["broken"] != 3 {
+		t.Errorf("failing font loaded %d times, want 3", calls["broken"])
+	}
+}
@@ -1,13 +1,16 @@
 package gif
 
 import (
-	"bytes"
 	"fmt"
 	"image"
 	"image/color"
-	"image/gif"
+	"image/draw"
+	"log"
 	"math"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fogleman/gg"
@@ -17,10 +20,13 @@ import (
 
 type Config struct {
 	EndTime    time.Time
+	Now        time.Time // Instant shown by the first frame; zero means time.Now()
 	Background color.Color
 	TextColor  color.Color
 	Width      int
 	Height     int
+	Layout     string // One of the Layout* modes; empty means horizontal
+	Transition string // One of the Transition* effects between seconds; empty means none
 
 	// Number styling
 	NumberFontName string
@@ -31,6 +37,9 @@ type Config struct {
 	LabelFontName string
 	LabelFontSize float64
 	LabelColor    color.Color
+	Locale        string    // Language of the built-in labels, e.g. "de" or "pt-BR"; defaults to English
+	Labels        [4]string // Custom days/hours/minutes/seconds labels, overriding Locale
+	LabelCase     string    // One of the LabelCase* options; empty leaves labels as written
 
 	// Separator styling
 	ShowSeparators bool
@@ -41,25 +50,34 @@ type Config struct {
 	ShowHours   bool
 	ShowMinutes bool
 	ShowSeconds bool
+	MinDigits   [4]int // Minimum digits per unit (days … seconds); 0 means 2
 
 	// Background options
 	Transparent    bool
+	MatteColor     color.Color // What transparent edges are blended against; defaults to white
 	RoundedCorners bool
 	CornerRadius   int
+	Dither         bool // Diffuse color error (Floyd–Steinberg) to smooth gradients and images
+
+	// Gradient and image backgrounds, drawn over Background
+	Gradient        Gradient
+	BackgroundImage string // ID of an uploaded background image
+	BackgroundFit   string // One of the Fit* modes; empty means cover
+
+	// Animation
+	Frames     int    // One of 10, 30, 60 or 120; 0 means 60
+	FrameDelay int    // Hundredths of a second per frame, 10 to 1000; 0 means 100
+	Loop       string // One of the Loop* behaviors; empty means forever
 
 	// Expired state
-	Expired        bool
-	ExpireBehavior string  // "show_zeros", "hide", "custom_text"
-	ExpireText     string  // Custom text to show when expired
-	ExpireTextFont string  // Font for expire text
-	ExpireTextSize float64 // Font size for expire text
+	Expired         bool
+	ExpireBehavior  string  // One of the Expire* behaviors; empty means show_zeros
+	ExpireText      string  // Custom text to show when expired
+	ExpireTextFont  string  // Font for expire text
+	ExpireTextSize  float64 // Font size for expire text
 	ExpireTextColor color.Color
 }
 
-func init() {
-	initFontRegistry()
-}
-
 // columnCount returns how many time columns are enabled.
 func (c Config) columnCount() int {
 	n := 0
@@ -118,53 +136,35 @@ func (c Config) labelFontSizeVal() float64 {
 	return 14
 }
 
-// CalcDimensions computes the ideal Width and Height based on font sizes, columns, labels, etc.
-func (c *Config) CalcDimensions() {
-	numFont := GetFont(c.NumberFontName)
-	numFace := truetype.NewFace(numFont, &truetype.Options{Size: c.numberFontSizeVal()})
-
-	dc := gg.NewContext(1, 1)
-	dc.SetFontFace(numFace)
-	numW, numH := dc.MeasureString("00")
-
-	numCols := c.columnCount()
-
-	// Column width: number width + horizontal padding on each side
-	colPad := c.numberFontSizeVal() * 0.25
-	if colPad < 6 {
-		colPad = 6
-	}
-	columnWidth := numW + colPad*2
-
-	// Separator gap between columns
-	sepGap := c.numberFontSizeVal() * 0.03
-	if sepGap < 1 {
-		sepGap = 1
-	}
-
-	totalWidth := columnWidth*float64(numCols) + sepGap*float64(numCols-1)
+// hasTransparency reports whether frames contain transparent pixels, either
+// from a transparent background or from the corners of a rounded one.
+func (c Config) hasTransparency() bool {
+	return c.Transparent || (c.RoundedCorners && c.CornerRadius > 0)
+}
 
-	// Height: top padding + number + gap + label + bottom padding
-	topPad := c.numberFontSizeVal() * 0.35
-	if topPad < 12 {
-		topPad = 12
+// matteColorVal returns the configured matte color or white, the most
+// common email background.
+func (c Config) matteColorVal() color.Color {
+	if c.MatteColor != nil {
+		return c.MatteColor
 	}
-	bottomPad := topPad
+	return color.White
+}
 
-	labelH := 0.0
-	labelGap := 0.0
-	if c.ShowLabels {
-		labelGap = c.numberFontSizeVal() * 0.08
-		if labelGap < 3 {
-			labelGap = 3
-		}
-		labelH = c.labelFontSizeVal() * 1.3
+// fillColor is the background drawn behind the timer, or transparent.
+func (c Config) fillColor() color.Color {
+	if c.Transparent {
+		return color.Transparent
 	}
+	return c.Background
+}
 
-	totalHeight := topPad + numH + labelGap + labelH + bottomPad
-
-	c.Width = int(math.Ceil(totalWidth))
-	c.Height = int(math.Ceil(totalHeight))
+// CalcDimensions computes the ideal Width and Height for the configured
+// layout based on font sizes, columns, labels, etc.
+func (c *Config) CalcDimensions() {
+	l := c.layout(c.columnDigits(c.frameValues(c.startTime(), c.frameCount())))
+	c.Width = l.width
+	c.Height = l.height
 }
 
 // ---------------------------------------------------------------------------
@@ -172,25 +172,150 @@ func (c *Config) CalcDimensions() {
 // ---------------------------------------------------------------------------
 
 type spriteCache struct {
-	sprites [100]*image.Paletted
-	spriteW int
+	// glyphs are the digits and separators numbers are composed from, keyed
+	// by rune. They are built once and only read afterwards.
+	glyphs  map[rune]*glyph
+	kerning map[[2]rune]float64
+	slotW   float64 // widest digit advance; columns are sized in slots
 	spriteH int
-	palette []color.Color
+	quant   *quantizer // maps drawn images onto the frame palette
+	bg      uint8      // palette index of the sprite background
+
+	// backdrop is the timer's background for gradients and images, which
+	// sprites are composed over in place; nil for flat backgrounds.
+	backdrop *image.RGBA
+	ink      color.Color
+
+	// spriteKeys maps number sprites composed over a backdrop back to
+	// their numberKey, so transitions can redraw their glyphs.
+	spriteKeys sync.Map
+
+	// numbers holds composed number sprites (numberKey → *image.Paletted),
+	// diffs the changed rectangle between two of them
+	// ([2]*image.Paletted → image.Rectangle) and tweens the transition
+	// frames between two of them (tweenKey → *image.Paletted), so warm
+	// renders skip all three.
+	numbers sync.Map
+	diffs   sync.Map
+	tweens  sync.Map
+
+	// items counts the entries of the four maps above; reset empties them
+	// once it reaches maxSpriteItems. mu is held for writing only by reset.
+	mu    sync.RWMutex
+	items atomic.Int64
+
+	size     atomic.Int64 // bytes held, counting map entries
+	baseSize int64        // bytes of the glyphs, backdrop and quantizer
+}
+
+const (
+	// maxSpriteItems bounds the memoized sprites, diffs and transition
+	// frames of one sprite cache, which otherwise grow for as long as it
+	// is in use.
+	maxSpriteItems = 8192
+
+	// spriteItemOverhead approximates the bytes of a map entry beyond the
+	// pixels it holds.
+	spriteItemOverhead = 64
+)
+
+// remember stores v under key in m unless it is already there, and returns
+// the stored value. bytes is the size of v's pixels.
+func (c *spriteCache) remember(m *sync.Map, key, v any, bytes int) any {
+	if c.items.Load() >= maxSpriteItems {
+		c.reset()
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	actual, loaded := m.LoadOrStore(key, v)
+	if !loaded {
+		c.items.Add(1)
+		c.size.Add(int64(bytes + spriteItemOverhead))
+	}
+	return actual
+}
+
+// reset empties the memoized maps. Renders holding sprites from before keep
+// them; a transition between two of those over a backdrop is drawn as a
+// cut, as its glyph keys are gone.
+func (c *spriteCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.items.Load() < maxSpriteItems {
+		return
+	}
+	c.numbers.Clear()
+	c.diffs.Clear()
+	c.tweens.Clear()
+	c.spriteKeys.Clear()
+	c.items.Store(0)
+	c.size.Store(c.baseSize)
+}
+
+// glyph is a single character rendered at sprite height. Its origin, where
+// the pen sits before drawing it, is originX pixels into img. Over a
+// backdrop only its coverage, mask, is kept.
+type glyph struct {
+	img     *image.Paletted
+	mask    *image.Alpha
+	originX int
+	advance float64
+}
+
+// glyphRunes are the characters cached for each sprite cache.
+const glyphRunes = "0123456789:"
+
+// changedRect returns the sprite-space rectangle that differs between two
+// number sprites of the same column.
+func (c *spriteCache) changedRect(from, to *image.Paletted) image.Rectangle {
+	key := [2]*image.Paletted{from, to}
+	if r, ok := c.diffs.Load(key); ok {
+		return r.(image.Rectangle)
+	}
+	return c.remember(&c.diffs, key, diffRect(from, to), 0).(image.Rectangle)
+}
+
+// diffRect returns the bounding rectangle of the pixels that differ between
+// two same-sized images.
+func diffRect(a, b *image.Paletted) image.Rectangle {
+	var r image.Rectangle
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		ra := a.Pix[a.PixOffset(bounds.Min.X, y):]
+		rb := b.Pix[b.PixOffset(bounds.Min.X, y):]
+		for x := 0; x < bounds.Dx(); x++ {
+			if ra[x] != rb[x] {
+				r = r.Union(image.Rect(bounds.Min.X+x, y, bounds.Min.X+x+1, y+1))
+			}
+		}
+	}
+	return r
 }
 
 type cacheKey struct {
 	BgColor        uint32
 	TextColor      uint32
+	LabelColor     uint32
+	SeparatorColor uint32
+	MatteColor     uint32
+	Transparent    bool
+	Rounded        bool
+	Dither         bool
 	NumberFontName string
 	NumberFontSize float64
-}
 
-var (
-	spriteCacheMap   = make(map[cacheKey]*spriteCache)
-	spriteCacheMapMu sync.RWMutex
-)
+	// Set only for gradient and image backgrounds, whose sprites depend on
+	// where they sit
+	Gradient        string
+	BackgroundImage string
+	BackgroundFit   string
+	Width, Height   int
+}
 
 func packColor(c color.Color) uint32 {
+	if c == nil {
+		return 0
+	}
 	r, g, b, a := c.RGBA()
 	return (r>>8)<<24 | (g>>8)<<16 | (b>>8)<<8 | (a >> 8)
 }
@@ -199,159 +324,161 @@ func getOrBuildSpriteCache(cfg Config) (*spriteCache, bool) {
 	key := cacheKey{
 		BgColor:        packColor(cfg.Background),
 		TextColor:      packColor(cfg.TextColor),
+		LabelColor:     packColor(cfg.LabelColor),
+		SeparatorColor: packColor(cfg.SeparatorColor),
+		MatteColor:     packColor(cfg.matteColorVal()),
+		Transparent:    cfg.Transparent,
+		Rounded:        cfg.hasTransparency(),
+		Dither:         cfg.Dither,
 		NumberFontName: cfg.NumberFontName,
 		NumberFontSize: cfg.numberFontSizeVal(),
 	}
-
-	spriteCacheMapMu.RLock()
-	if cached, ok := spriteCacheMap[key]; ok {
-		spriteCacheMapMu.RUnlock()
-		return cached, true
+	if cfg.textured() {
+		key.Gradient = fmt.Sprintf("%v", cfg.Gradient)
+		key.BackgroundImage = cfg.BackgroundImage
+		key.BackgroundFit = cfg.BackgroundFit
+		key.Width, key.Height = cfg.Width, cfg.Height
 	}
-	spriteCacheMapMu.RUnlock()
 
-	numberFont := GetFont(cfg.NumberFontName)
-	numberFace := truetype.NewFace(numberFont, &truetype.Options{Size: cfg.numberFontSizeVal()})
-	cache := buildSpriteCache(cfg, numberFace)
-
-	spriteCacheMapMu.Lock()
-	spriteCacheMap[key] = cache
-	spriteCacheMapMu.Unlock()
-
-	return cache, false
+	return spriteCaches.get(key, func() *spriteCache {
+		numberFont := GetFont(cfg.NumberFontName)
+		numberFace := truetype.NewFace(numberFont, &truetype.Options{Size: cfg.numberFontSizeVal()})
+		return buildSpriteCache(cfg, numberFace)
+	})
 }
 
 func buildSpriteCache(cfg Config, numberFace font.Face) *spriteCache {
-	palette := createPalette(cfg.Background, cfg.TextColor, cfg.LabelColor, cfg.SeparatorColor)
-
-	dc := gg.NewContext(1, 1)
-	dc.SetFontFace(numberFace)
-	tw, th := dc.MeasureString("00")
-	pad := 6.0
-	spriteW := int(tw + pad*2)
-	spriteH := int(th + pad*2)
+	spriteH, numH := spriteHeight(numberFace)
+	baseline := float64(spriteH)/2 + numH/2
 
 	cache := &spriteCache{
-		spriteW: spriteW,
+		glyphs:  make(map[rune]*glyph, len(glyphRunes)),
+		kerning: make(map[[2]rune]float64),
+		slotW:   digitSlotWidth(numberFace),
 		spriteH: spriteH,
-		palette: palette,
+		ink:     cfg.TextColor,
+	}
+	if cfg.textured() {
+		cache.backdrop = cfg.backdrop()
+		cache.size.Add(int64(len(cache.backdrop.Pix)))
 	}
+	palette := cfg.palette(cache.backdrop, cfg.TextColor, cfg.LabelColor, cfg.SeparatorColor)
+	cache.quant = newQuantizer(palette, cfg.matteColorVal(), cfg.Dither)
+	cache.size.Add(cache.quant.bytes())
 
-	numberFont := GetFont(cfg.NumberFontName)
-	for v := 0; v < 100; v++ {
-		txt := fmt.Sprintf("%02d", v)
-		nf := truetype.NewFace(numberFont, &truetype.Options{Size: cfg.numberFontSizeVal()})
+	for _, r := range glyphRunes {
+		bounds, advance := font.BoundString(numberFace, string(r))
+		minX := bounds.Min.X.Floor() - 1
+		w := bounds.Max.X.Ceil() + 1 - minX
 
-		dc := gg.NewContext(spriteW, spriteH)
-		dc.SetColor(cfg.Background)
-		dc.Clear()
-		dc.SetFontFace(nf)
+		dc := gg.NewContext(w, spriteH)
+		if cache.backdrop == nil {
+			dc.SetColor(cfg.fillColor())
+			dc.Clear()
+		}
+		dc.SetFontFace(numberFace)
 		dc.SetColor(cfg.TextColor)
-		dc.DrawStringAnchored(txt, float64(spriteW)/2, float64(spriteH)/2, 0.5, 0.5)
+		dc.DrawString(string(r), float64(-minX), baseline)
 
-		cache.sprites[v] = quantizeNearestNeighbor(
-			dc.Image(),
-			image.Rect(0, 0, spriteW, spriteH),
-			palette,
-		)
+		g := &glyph{originX: -minX, advance: float64(advance) / 64}
+		if cache.backdrop != nil {
+			g.mask = image.NewAlpha(image.Rect(0, 0, w, spriteH))
+			draw.Draw(g.mask, g.mask.Rect, dc.Image(), image.Point{}, draw.Src)
+		} else {
+			g.img = cache.quant.quantize(dc.Image(), image.Rect(0, 0, w, spriteH))
+		}
+		cache.glyphs[r] = g
+		cache.size.Add(int64(w * spriteH))
 	}
-
-	return cache
-}
-
-func buildBaseFrame(cfg Config, palette []color.Color, labelFace font.Face, spriteH int) *image.Paletted {
-	dc := gg.NewContext(cfg.Width, cfg.Height)
-
-	// Draw rounded rectangle background or plain fill
-	if cfg.RoundedCorners && cfg.CornerRadius > 0 {
-		dc.SetColor(color.Transparent)
-		dc.Clear()
-		radius := float64(cfg.CornerRadius)
-		dc.DrawRoundedRectangle(0, 0, float64(cfg.Width), float64(cfg.Height), radius)
-		dc.SetColor(cfg.Background)
-		dc.Fill()
-	} else {
-		dc.SetColor(cfg.Background)
-		dc.Clear()
+	for _, a := range glyphRunes {
+		for _, b := range glyphRunes {
+			if k := numberFace.Kern(a, b); k != 0 {
+				cache.kerning[[2]rune{a, b}] = float64(k) / 64
+			}
+		}
 	}
 
-	allLabels := []string{"Days", "Hours", "Minutes", "Seconds"}
-	enabledCols := cfg.enabledColumns()
-	numCols := len(enabledCols)
-
-	// Calculate dynamic spacing based on number font size
-	fontSize := cfg.numberFontSizeVal()
-	colPad := fontSize * 0.25
-	if colPad < 4 {
-		colPad = 4
-	}
-	topPad := fontSize * 0.35
-	if topPad < 12 {
-		topPad = 12
+	// The fill around the glyphs quantizes to the same index everywhere
+	if cache.backdrop == nil {
+		cache.bg = cache.glyphs['0'].img.Pix[0]
 	}
 
-	// Number center Y position
-	numCenterY := topPad + float64(spriteH)/2
-
-	// Separator dimensions scale with number font size
-	sepHeight := fontSize * 0.6
-	sepLineWidth := math.Max(1.5, fontSize*0.04)
-	sepOffsetY := 10.0 // push separator down for alignment
-
-	// Column width
-	sepGap := fontSize * 0.03
-	if sepGap < 1 {
-		sepGap = 1
-	}
+	cache.baseSize = cache.size.Load()
+	return cache
+}
 
-	numFont := GetFont(cfg.NumberFontName)
-	numFace := truetype.NewFace(numFont, &truetype.Options{Size: fontSize})
-	dcMeasure := gg.NewContext(1, 1)
-	dcMeasure.SetFontFace(numFace)
-	numW, _ := dcMeasure.MeasureString("00")
-	columnWidth := numW + colPad*2
+// buildBaseFrame draws everything but the numbers, with labels in the plural
+// forms for vals. A gradient or image background is drawn from backdrop.
+func buildBaseFrame(cfg Config, quant *quantizer, backdrop *image.RGBA, labelFace font.Face, lay layout, vals [4]int) *image.Paletted {
+	dc := gg.NewContext(cfg.Width, cfg.Height)
+	fillBackground(dc, cfg, backdrop)
 
 	// Draw labels
-	if cfg.ShowLabels {
+	if len(lay.labels) > 0 {
 		dc.SetFontFace(labelFace)
 		labelColor := cfg.LabelColor
 		if labelColor == nil {
 			labelColor = cfg.TextColor
 		}
 		dc.SetColor(labelColor)
-
-		labelGap := fontSize * 0.08
-		if labelGap < 3 {
-			labelGap = 3
+		for _, t := range lay.labels {
+			dc.DrawStringAnchored(cfg.unitLabel(t.unit, vals[t.unit]), t.x, t.y, t.ax, t.ay)
 		}
-		labelY := topPad + float64(spriteH) + labelGap + cfg.labelFontSizeVal()*0.5
+	}
 
-		for i, colIdx := range enabledCols {
-			x := float64(i)*(columnWidth+sepGap) + columnWidth/2
-			dc.DrawStringAnchored(allLabels[colIdx], x, labelY, 0.5, 0.5)
+	sepColor := cfg.SeparatorColor
+	if sepColor == nil {
+		sepColor = cfg.TextColor
+	}
+
+	// Inline text between the numbers
+	if len(lay.texts) > 0 {
+		numFace := truetype.NewFace(GetFont(cfg.NumberFontName), &truetype.Options{Size: cfg.numberFontSizeVal()})
+		dc.SetFontFace(numFace)
+		for _, t := range lay.texts {
+			if t.sep {
+				dc.SetColor(sepColor)
+			} else {
+				dc.SetColor(cfg.TextColor)
+			}
+			dc.DrawStringAnchored(t.text, t.x, t.y, t.ax, t.ay)
 		}
 	}
 
 	// Draw separators
-	if cfg.ShowSeparators {
-		sepColor := cfg.SeparatorColor
-		if sepColor == nil {
-			sepColor = cfg.TextColor
-		}
-		dc.SetColor(sepColor)
-		dc.SetLineWidth(sepLineWidth)
-		for i := 0; i < numCols-1; i++ {
-			separatorX := float64(i+1)*columnWidth + float64(i)*sepGap + sepGap/2
-			dc.DrawLine(separatorX, numCenterY-sepHeight/2+sepOffsetY, separatorX, numCenterY+sepHeight/2+sepOffsetY)
-			dc.Stroke()
-		}
+	dc.SetColor(sepColor)
+	dc.SetLineWidth(lay.lineW)
+	for _, ln := range lay.lines {
+		dc.DrawLine(ln[0], ln[1], ln[2], ln[3])
+		dc.Stroke()
 	}
 
-	return quantizeNearestNeighbor(
-		dc.Image(),
-		image.Rect(0, 0, cfg.Width, cfg.Height),
-		palette,
-	)
+	return quant.quantize(dc.Image(), image.Rect(0, 0, cfg.Width, cfg.Height))
+}
+
+// fillBackground draws the background: the backdrop or flat color, inside a
+// rounded rectangle if the corners are rounded.
+func fillBackground(dc *gg.Context, cfg Config, backdrop *image.RGBA) {
+	w, h := float64(dc.Width()), float64(dc.Height())
+	if cfg.Transparent {
+		dc.SetColor(color.Transparent)
+		dc.Clear()
+		return
+	}
+
+	if cfg.RoundedCorners && cfg.CornerRadius > 0 {
+		dc.SetColor(color.Transparent)
+		dc.Clear()
+		dc.DrawRoundedRectangle(0, 0, w, h, min(float64(cfg.CornerRadius), w/2, h/2))
+	} else {
+		dc.DrawRectangle(0, 0, w, h)
+	}
+	if backdrop != nil {
+		dc.SetFillStyle(gg.NewSurfacePattern(backdrop, gg.RepeatNone))
+	} else {
+		dc.SetColor(cfg.Background)
+	}
+	dc.Fill()
 }
 
 func stampSprite(dst *image.Paletted, sprite *image.Paletted, x, y int) {
@@ -377,74 +504,132 @@ func stampSprite(dst *image.Paletted, sprite *image.Paletted, x, y int) {
 	}
 }
 
-func computeDiff(prev, curr *image.Paletted) *image.Paletted {
-	bounds := curr.Bounds()
-	w := bounds.Dx()
-	h := bounds.Dy()
-	stride := curr.Stride
-
-	minX, minY := w, h
-	maxX, maxY := 0, 0
+// composeFrame renders the part of a frame inside rect: the base frame with
+// every column sprite overlapping rect stamped on top.
+func composeFrame(base *image.Paletted, rect image.Rectangle, sprites []*image.Paletted, colRects []image.Rectangle) *image.Paletted {
+	frame := image.NewPaletted(rect, base.Palette)
+	w := rect.Dx()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		srcOffset := base.PixOffset(rect.Min.X, y)
+		dstOffset := frame.PixOffset(rect.Min.X, y)
+		copy(frame.Pix[dstOffset:dstOffset+w], base.Pix[srcOffset:srcOffset+w])
+	}
 
-	for y := 0; y < h; y++ {
-		rowOffset := y * stride
-		for x := 0; x < w; x++ {
-			if prev.Pix[rowOffset+x] != curr.Pix[rowOffset+x] {
-				if x < minX {
-					minX = x
-				}
-				if x > maxX {
-					maxX = x
-				}
-				if y < minY {
-					minY = y
-				}
-				if y > maxY {
-					maxY = y
-				}
-			}
+	for col, sprite := range sprites {
+		if colRects[col].Overlaps(rect) {
+			stampSprite(frame, sprite, colRects[col].Min.X, colRects[col].Min.Y)
 		}
 	}
 
-	if maxX < minX {
-		tiny := image.NewPaletted(image.Rect(0, 0, 1, 1), curr.Palette)
-		tiny.Pix[0] = 0
-		return tiny
-	}
+	return frame
+}
 
-	diffRect := image.Rect(minX, minY, maxX+1, maxY+1)
-	diff := image.NewPaletted(diffRect, curr.Palette)
+// frameChange describes what differs between a frame and the one before it.
+type frameChange struct {
+	rect     image.Rectangle // union of changed pixels, in frame coordinates
+	cols     int             // number of columns whose value changed
+	lastCol  int             // index into enabled columns of the last change
+	lastRect image.Rectangle // changed pixels of lastCol
+}
+
+// cropPaletted copies the r part of src into a new image.
+func cropPaletted(src *image.Paletted, r image.Rectangle) *image.Paletted {
+	dst := image.NewPaletted(r, src.Palette)
+	w := r.Dx()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		copy(dst.Pix[dst.PixOffset(r.Min.X, y):][:w], src.Pix[src.PixOffset(r.Min.X, y):][:w])
+	}
+	return dst
+}
 
-	diffW := diffRect.Dx()
-	for y := diffRect.Min.Y; y < diffRect.Max.Y; y++ {
-		srcOffset := y*stride + diffRect.Min.X
-		dstOffset := (y - diffRect.Min.Y) * diff.Stride
-		copy(diff.Pix[dstOffset:dstOffset+diffW], curr.Pix[srcOffset:srcOffset+diffW])
+// spriteView returns the r part of sprite, positioned in frame coordinates
+// by offset pt and sharing the sprite's pixels.
+func spriteView(sprite *image.Paletted, r image.Rectangle, pt image.Point) *image.Paletted {
+	return &image.Paletted{
+		Pix:     sprite.Pix[sprite.PixOffset(r.Min.X, r.Min.Y):],
+		Stride:  sprite.Stride,
+		Rect:    r.Add(pt),
+		Palette: sprite.Palette,
 	}
+}
 
-	return diff
+// timings receives how long each step of a render took.
+var timings = log.New(os.Stdout, "", 0)
+
+// SetTimingLogger sets where render timings are written. It should be
+// called before rendering starts.
+func SetTimingLogger(l *log.Logger) {
+	timings = l
 }
 
+// Generate renders cfg as a GIF.
 func Generate(cfg Config) ([]byte, error) {
+	return GenerateFormat(cfg, FormatGIF)
+}
+
+// GenerateFormat renders cfg and encodes it in format. Still formats get a
+// snapshot rather than the whole animation.
+func GenerateFormat(cfg Config, format Format) ([]byte, error) {
 	start := time.Now()
 
-	// Handle expired "hide" — return a 1x1 transparent GIF
-	if cfg.Expired && cfg.ExpireBehavior == "hide" {
-		return generateHideGIF()
+	render := Render
+	if !format.Animated() {
+		render = Snapshot
+	}
+	anim, err := render(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	// Handle expired "custom_text" — single frame with centered text
-	if cfg.Expired && cfg.ExpireBehavior == "custom_text" && cfg.ExpireText != "" {
-		return generateCustomTextGIF(cfg)
+	encodeStart := time.Now()
+	data, err := anim.encode(format)
+	timings.Printf("%s encoded in: %v", strings.ToUpper(string(format)), time.Since(encodeStart))
+	if err != nil {
+		return nil, err
+	}
+	timings.Printf("%s size: %d bytes (%d KB)", strings.ToUpper(string(format)), len(data), len(data)/1024)
+	timings.Printf("Total: %v", time.Since(start))
+
+	return data, nil
+}
+
+// Render draws the frames of cfg's countdown.
+func Render(cfg Config) (*Animation, error) {
+	return render(cfg, false)
+}
+
+// Snapshot draws the single frame cfg's countdown shows at cfg.Now, for
+// clients that would only show an animation's first frame anyway.
+func Snapshot(cfg Config) (*Animation, error) {
+	return render(cfg, true)
+}
+
+func render(cfg Config, still bool) (*Animation, error) {
+	start := time.Now()
+
+	// A countdown whose end time has passed renders its expired state
+	cfg.Expired = cfg.expiredAt(cfg.startTime())
+
+	// Handle expired "hide" — a 1x1 transparent frame
+	if cfg.Expired && cfg.ExpireBehavior == ExpireHide {
+		return renderHide(cfg), nil
 	}
 
-	frames := 60
-	delay := 100
+	// Handle expired "custom_text" — single frame with centered text
+	if cfg.Expired && cfg.ExpireBehavior == ExpireCustomText && cfg.ExpireText != "" {
+		return renderCustomText(cfg), nil
+	}
 
-	// Expired mode (show_zeros): single frame with all zeros
-	if cfg.Expired {
+	// Expired mode (show_zeros) is a single frame with all zeros
+	frames := cfg.frameCount()
+	if still {
 		frames = 1
 	}
+	delay := cfg.frameDelay()
+
+	// Pin the start so sizing and frames agree on the values shown
+	cfg.Now = cfg.startTime()
+	now := cfg.Now
 
 	// Auto-calculate dimensions if not explicitly set or if set to 0
 	if cfg.Width == 0 || cfg.Height == 0 {
@@ -454,135 +639,207 @@ func Generate(cfg Config) ([]byte, error) {
 	// Use cached sprites instead of building every time
 	cache, cacheHit := getOrBuildSpriteCache(cfg)
 	if cacheHit {
-		fmt.Println("Sprite cache HIT")
+		timings.Println("Sprite cache HIT")
 	} else {
-		fmt.Printf("Sprite cache MISS — built in: %v\n", time.Since(start))
+		timings.Printf("Sprite cache MISS — built in: %v", time.Since(start))
 	}
 
 	labelFont := GetFont(cfg.LabelFontName)
 	labelFace := truetype.NewFace(labelFont, &truetype.Options{Size: cfg.labelFontSizeVal()})
-	baseFrame := buildBaseFrame(cfg, cache.palette, labelFace, cache.spriteH)
 
 	stampStart := time.Now()
 	enabledCols := cfg.enabledColumns()
 
-	// Calculate column positions using same logic as buildBaseFrame
-	fontSize := cfg.numberFontSizeVal()
-	colPad := fontSize * 0.25
-	if colPad < 4 {
-		colPad = 4
-	}
-	topPad := fontSize * 0.35
-	if topPad < 12 {
-		topPad = 12
-	}
-	sepGap := fontSize * 0.03
-	if sepGap < 1 {
-		sepGap = 1
+	// Work out every frame's values up front so each frame can tell which
+	// columns changed since the previous one without scanning pixels.
+	values := cfg.frameValues(now, frames)
+	digits := cfg.columnDigits(values)
+	lay := cfg.layout(digits)
+
+	// Each frame's sprite per column. Columns other than two digits wide
+	// are composed, so share one sprite per distinct value.
+	sprites := make([][]*image.Paletted, frames)
+	for col, unit := range enabledCols {
+		composed := make(map[int]*image.Paletted)
+		for i, vals := range values {
+			if sprites[i] == nil {
+				sprites[i] = make([]*image.Paletted, len(enabledCols))
+			}
+			sp, ok := composed[vals[unit]]
+			if !ok {
+				sp = cache.valueSprite(vals[unit], cfg.minDigits(unit), digits[col], lay.numAlign, lay.colRects[col].Min)
+				composed[vals[unit]] = sp
+			}
+			sprites[i][col] = sp
+		}
 	}
 
-	numFont := GetFont(cfg.NumberFontName)
-	numFace := truetype.NewFace(numFont, &truetype.Options{Size: fontSize})
-	dcMeasure := gg.NewContext(1, 1)
-	dcMeasure.SetFontFace(numFace)
-	numW, _ := dcMeasure.MeasureString("00")
-	columnWidth := numW + colPad*2
-
-	numY := int(topPad)
-
-	fullFrames := make([]*image.Paletted, frames)
-
-	for i := 0; i < frames; i++ {
-		var days, hours, minutes, seconds int
-		if cfg.Expired {
-			// All zeros for expired state
-			days, hours, minutes, seconds = 0, 0, 0, 0
-		} else {
-			remaining := time.Until(cfg.EndTime) - time.Duration(i)*time.Second
-			days, hours, minutes, seconds = splitDuration(remaining)
+	// Labels follow the plural form of their unit's value, so each distinct
+	// set of labels gets its own base frame. labelRects holds where labels
+	// changed form since the frame before.
+	labelSets := make([][4]string, frames)
+	labelRects := make([]image.Rectangle, frames)
+	bases := make([]*image.Paletted, frames)
+	baseByLabels := make(map[[4]string]*image.Paletted)
+	for i, vals := range values {
+		for _, t := range lay.labels {
+			labelSets[i][t.unit] = cfg.unitLabel(t.unit, vals[t.unit])
+			if i > 0 && labelSets[i-1][t.unit] != labelSets[i][t.unit] {
+				labelRects[i] = labelRects[i].
+					Union(t.textBounds(labelFace, labelSets[i-1][t.unit])).
+					Union(t.textBounds(labelFace, labelSets[i][t.unit]))
+			}
 		}
-
-		frame := image.NewPaletted(baseFrame.Bounds(), cache.palette)
-		copy(frame.Pix, baseFrame.Pix)
-
-		allValues := []int{days, hours, minutes, seconds}
-		for col, colIdx := range enabledCols {
-			val := allValues[colIdx]
-			cx := int(float64(col)*(columnWidth+sepGap) + columnWidth/2)
-			pasteX := cx - cache.spriteW/2
-			stampSprite(frame, cache.sprites[val], pasteX, numY)
+		base, ok := baseByLabels[labelSets[i]]
+		if !ok {
+			base = buildBaseFrame(cfg, cache.quant, cache.backdrop, labelFace, lay, vals)
+			baseByLabels[labelSets[i]] = base
 		}
-
-		fullFrames[i] = frame
+		bases[i] = base
 	}
-	fmt.Printf("%d frames stamped in: %v\n", frames, time.Since(stampStart))
+	baseFrame := bases[0]
+
+	colRects := lay.colRects
 
-	diffStart := time.Now()
-	anim := gif.GIF{
-		Image:     make([]*image.Paletted, frames),
-		Delay:     make([]int, frames),
-		Disposal:  make([]byte, frames),
-		LoopCount: 0,
+	anim := &Animation{
+		Width:  baseFrame.Rect.Dx(),
+		Height: baseFrame.Rect.Dy(),
+		Frames: make([]Frame, frames),
+		Plays:  cfg.plays(),
+		Matte:  cfg.matteColorVal(),
 	}
 
-	anim.Image[0] = fullFrames[0]
-	anim.Delay[0] = delay
-	anim.Disposal[0] = gif.DisposalNone
+	// Only the pixels of columns whose value changed need redrawing; the
+	// sprite cache already knows which ones those are.
+	changes := make([]frameChange, frames)
+	parallelFor(frames-1, func(j int) {
+		i := j + 1
+		for col, colIdx := range enabledCols {
+			prev, cur := values[i-1][colIdx], values[i][colIdx]
+			if prev == cur {
+				continue
+			}
+			r := cache.changedRect(sprites[i-1][col], sprites[i][col])
+			// A transition leaves its whole region to be redrawn
+			r = cfg.transitionRect(r, cache.spriteH).Add(colRects[col].Min)
+			changes[i].rect = changes[i].rect.Union(r)
+			changes[i].cols++
+			changes[i].lastCol = col
+			changes[i].lastRect = r
+		}
+		// Labels that changed form are redrawn from the frame's base
+		changes[i].rect = changes[i].rect.Union(labelRects[i])
+	})
+
+	// Transparent pixels in a diff frame would let the previous digit show
+	// through, so transparent timers redraw one fixed region per frame and
+	// clear it before the next frame is drawn.
+	var redrawRect image.Rectangle
+	if cfg.Transparent {
+		for _, c := range changes {
+			redrawRect = redrawRect.Union(c.rect)
+		}
+		redrawRect = redrawRect.Intersect(baseFrame.Bounds())
+	}
+
+	parallelFor(frames, func(i int) {
+		f := &anim.Frames[i]
+		f.Delay = delay
+		c := changes[i]
+
+		switch {
+		case i == 0:
+			f.Image = composeFrame(baseFrame, baseFrame.Bounds(), sprites[0], colRects)
+		case !redrawRect.Empty():
+			f.Image = composeFrame(bases[i], redrawRect, sprites[i], colRects)
+			f.Clear = true
+		case c.rect.Empty():
+			tiny := image.NewPaletted(image.Rect(0, 0, 1, 1), cache.quant.palette)
+			copy(tiny.Pix, baseFrame.Pix[:1])
+			f.Image = tiny
+		case c.cols == 1 && c.rect == c.lastRect && c.lastRect.In(baseFrame.Bounds()):
+			// The usual case: a single column ticked over and its sprite
+			// already holds the exact pixels, so emit them in place.
+			f.Image = spriteView(sprites[i][c.lastCol], c.lastRect.Sub(colRects[c.lastCol].Min), colRects[c.lastCol].Min)
+		default:
+			f.Image = composeFrame(bases[i], c.rect.Intersect(baseFrame.Bounds()), sprites[i], colRects)
+		}
+	})
 
-	for i := 1; i < frames; i++ {
-		anim.Image[i] = computeDiff(fullFrames[i-1], fullFrames[i])
-		anim.Delay[i] = delay
-		anim.Disposal[i] = gif.DisposalNone
+	if tweenDelay := cfg.tweenDelay(); tweenDelay > 0 {
+		anim.Frames = withTransitions(anim.Frames, buildTransitions(cfg, cache, values, sprites, bases, colRects, redrawRect), tweenDelay)
 	}
-	fmt.Printf("Diffs computed in: %v\n", time.Since(diffStart))
 
-	encodeStart := time.Now()
-	var buf bytes.Buffer
-	err := gif.EncodeAll(&buf, &anim)
-	fmt.Printf("GIF encoded in: %v\n", time.Since(encodeStart))
-	fmt.Printf("GIF size: %d bytes (%d KB)\n", buf.Len(), buf.Len()/1024)
-	fmt.Printf("Total: %v\n", time.Since(start))
-
-	if err != nil {
-		return nil, err
+	if !redrawRect.Empty() {
+		// The first frame has to be shown in full but must only clear the
+		// redraw region, so it is split in two: the full frame, then the
+		// same pixels of the redraw region, which get cleared.
+		first := anim.Frames[0]
+		split := min(10, first.Delay/2)
+		anim.Frames = append([]Frame{
+			{Image: first.Image, Delay: first.Delay - split},
+			{Image: cropPaletted(first.Image, redrawRect), Delay: split, Clear: true},
+		}, anim.Frames[1:]...)
 	}
+	timings.Printf("%d frames built in: %v", frames, time.Since(stampStart))
 
-	return buf.Bytes(), nil
+	return anim, nil
 }
 
-func quantizeNearestNeighbor(src image.Image, bounds image.Rectangle, palette []color.Color) *image.Paletted {
-	dst := image.NewPaletted(bounds, palette)
-
-	type rgbaColor struct{ r, g, b uint32 }
-	palRGBA := make([]rgbaColor, len(palette))
-	for i, c := range palette {
-		r, g, b, _ := c.RGBA()
-		palRGBA[i] = rgbaColor{r >> 8, g >> 8, b >> 8}
-	}
-
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, _ := src.At(x, y).RGBA()
-			sr, sg, sb := r>>8, g>>8, b>>8
-
-			bestIdx := 0
-			bestDist := uint32(1<<32 - 1)
-			for i, pc := range palRGBA {
-				dr := sr - pc.r
-				dg := sg - pc.g
-				db := sb - pc.b
-				dist := dr*dr + dg*dg + db*db
-				if dist < bestDist {
-					bestDist = dist
-					bestIdx = i
+// buildTransitions returns, for each frame, the transition frames leading
+// into it from the frame before. They are drawn over the previous frame's
+// labels, and over redrawRect if it is set.
+func buildTransitions(cfg Config, cache *spriteCache, values [][4]int, sprites [][]*image.Paletted, bases []*image.Paletted, colRects []image.Rectangle, redrawRect image.Rectangle) [][]*image.Paletted {
+	enabledCols := cfg.enabledColumns()
+	bounds := bases[0].Bounds()
+	tweens := make([][]*image.Paletted, len(values))
+
+	parallelFor(len(values)-1, func(j int) {
+		i := j + 1
+		regions := make([]image.Rectangle, len(enabledCols))
+		var rect image.Rectangle
+		for col, unit := range enabledCols {
+			if values[i-1][unit] == values[i][unit] {
+				continue
+			}
+			regions[col] = cfg.transitionRect(cache.changedRect(sprites[i-1][col], sprites[i][col]), cache.spriteH)
+			rect = rect.Union(regions[col].Add(colRects[col].Min))
+		}
+		if rect.Empty() {
+			return
+		}
+		if !redrawRect.Empty() {
+			rect = redrawRect
+		}
+		rect = rect.Intersect(bounds)
+
+		tweens[i] = make([]*image.Paletted, transitionSteps)
+		for step := range tweens[i] {
+			stepSprites := append([]*image.Paletted(nil), sprites[i-1]...)
+			for col, region := range regions {
+				if !region.Empty() {
+					stepSprites[col] = cache.tweenSprite(cfg.Transition, sprites[i-1][col], sprites[i][col], region, step)
 				}
 			}
+			tweens[i][step] = composeFrame(bases[i-1], rect, stepSprites, colRects)
+		}
+	})
+	return tweens
+}
 
-			dst.SetColorIndex(x, y, uint8(bestIdx))
+// withTransitions inserts each frame's transition frames before it, taking
+// their delay out of the frame's own so the loop keeps its length. They are
+// cleared like the frame they lead into.
+func withTransitions(frames []Frame, tweens [][]*image.Paletted, tweenDelay int) []Frame {
+	var out []Frame
+	for i, frame := range frames {
+		for _, tween := range tweens[i] {
+			out = append(out, Frame{Image: tween, Delay: tweenDelay, Clear: frame.Clear})
+			frame.Delay -= tweenDelay
 		}
+		out = append(out, frame)
 	}
-
-	return dst
+	return out
 }
 
 func splitDuration(remaining time.Duration) (int, int, int, int) {
@@ -596,26 +853,15 @@ func splitDuration(remaining time.Duration) (int, int, int, int) {
 	return days, hours, minutes, seconds
 }
 
-func generateHideGIF() ([]byte, error) {
+func renderHide(cfg Config) *Animation {
 	palette := []color.Color{color.Transparent}
 	frame := image.NewPaletted(image.Rect(0, 0, 1, 1), palette)
 	frame.SetColorIndex(0, 0, 0)
 
-	anim := gif.GIF{
-		Image:     []*image.Paletted{frame},
-		Delay:     []int{0},
-		Disposal:  []byte{gif.DisposalNone},
-		LoopCount: 0,
-	}
-
-	var buf bytes.Buffer
-	if err := gif.EncodeAll(&buf, &anim); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+	return &Animation{Width: 1, Height: 1, Frames: []Frame{{Image: frame}}, Matte: cfg.matteColorVal()}
 }
 
-func generateCustomTextGIF(cfg Config) ([]byte, error) {
+func renderCustomText(cfg Config) *Animation {
 	textSize := cfg.ExpireTextSize
 	if textSize <= 0 {
 		textSize = 24
@@ -648,73 +894,20 @@ func generateCustomTextGIF(cfg Config) ([]byte, error) {
 	}
 
 	// Draw frame
-	dc = gg.NewContext(width, height)
-	if cfg.RoundedCorners && cfg.CornerRadius > 0 {
-		dc.SetColor(color.Transparent)
-		dc.Clear()
-		dc.DrawRoundedRectangle(0, 0, float64(width), float64(height), float64(cfg.CornerRadius))
-		dc.SetColor(cfg.Background)
-		dc.Fill()
-	} else {
-		dc.SetColor(cfg.Background)
-		dc.Clear()
+	cfg.Width, cfg.Height = width, height
+	var backdrop *image.RGBA
+	if cfg.textured() {
+		backdrop = cfg.backdrop()
 	}
+	quant := newQuantizer(cfg.palette(backdrop, textColor), cfg.matteColorVal(), cfg.Dither)
+	dc = gg.NewContext(width, height)
+	fillBackground(dc, cfg, backdrop)
 
 	dc.SetFontFace(textFace)
 	dc.SetColor(textColor)
 	dc.DrawStringAnchored(cfg.ExpireText, float64(width)/2, float64(height)/2, 0.5, 0.5)
 
-	palette := createPalette(cfg.Background, textColor)
-	frame := quantizeNearestNeighbor(dc.Image(), image.Rect(0, 0, width, height), palette)
-
-	anim := gif.GIF{
-		Image:     []*image.Paletted{frame},
-		Delay:     []int{0},
-		Disposal:  []byte{gif.DisposalNone},
-		LoopCount: 0,
-	}
-
-	var buf bytes.Buffer
-	if err := gif.EncodeAll(&buf, &anim); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
-}
-
-func createPalette(bg, text color.Color, extra ...color.Color) []color.Color {
-	bgR, bgG, bgB, _ := bg.RGBA()
-	textR, textG, textB, _ := text.RGBA()
-
-	palette := []color.Color{bg}
-	steps := 6
-	for i := 1; i <= steps; i++ {
-		t := float64(i) / float64(steps+1)
-		palette = append(palette, color.RGBA{
-			R: uint8(float64(bgR>>8)*(1-t) + float64(textR>>8)*t),
-			G: uint8(float64(bgG>>8)*(1-t) + float64(textG>>8)*t),
-			B: uint8(float64(bgB>>8)*(1-t) + float64(textB>>8)*t),
-			A: 255,
-		})
-	}
-	palette = append(palette, text)
-
-	// Add extra colors (label, separator) with interpolation steps to bg
-	for _, ec := range extra {
-		if ec == nil {
-			continue
-		}
-		ecR, ecG, ecB, _ := ec.RGBA()
-		for i := 1; i <= 3; i++ {
-			t := float64(i) / 4.0
-			palette = append(palette, color.RGBA{
-				R: uint8(float64(bgR>>8)*(1-t) + float64(ecR>>8)*t),
-				G: uint8(float64(bgG>>8)*(1-t) + float64(ecG>>8)*t),
-				B: uint8(float64(bgB>>8)*(1-t) + float64(ecB>>8)*t),
-				A: 255,
-			})
-		}
-		palette = append(palette, ec)
-	}
+	frame := quant.quantize(dc.Image(), image.Rect(0, 0, width, height))
 
-	return palette
+	return &Animation{Width: width, Height: height, Frames: []Frame{{Image: frame}}, Matte: cfg.matteColorVal()}
 }
@@ -0,0 +1,73 @@
+package gif
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	if err := LoadFonts(filepath.Join("..", "fonts")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// Renders log their timings; keep them out of test and benchmark output.
+	SetTimingLogger(log.New(io.Discard, "", 0))
+	os.Exit(m.Run())
+}
+
+func benchmarkConfig(fontSize float64) Config {
+	cfg := Config{
+		EndTime:        time.Now().Add(50*time.Hour + 30*time.Second),
+		Background:     color.RGBA{R: 17, G: 34, B: 51, A: 255},
+		TextColor:      color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		NumberFontSize: fontSize,
+		ShowLabels:     true,
+		LabelFontSize:  fontSize / 4,
+		LabelColor:     color.RGBA{R: 200, G: 200, B: 200, A: 255},
+		ShowSeparators: true,
+		SeparatorColor: color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		ShowDays:       true,
+		ShowHours:      true,
+		ShowMinutes:    true,
+		ShowSeconds:    true,
+	}
+	cfg.CalcDimensions()
+	return cfg
+}
+
+// BenchmarkGenerate compares a single-threaded render against one spread
+// over GOMAXPROCS workers, for increasingly large font sizes.
+func BenchmarkGenerate(b *testing.B) {
+	procsList := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		procsList = append(procsList, n)
+	}
+
+	for _, size := range []float64{60, 120, 200} {
+		for _, procs := range procsList {
+			b.Run(fmt.Sprintf("size=%.0f/procs=%d", size, procs), func(b *testing.B) {
+				defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+				cfg := benchmarkConfig(size)
+
+				// Warm the sprite cache so only frame work is measured.
+				if _, err := Generate(cfg); err != nil {
+					b.Fatal(err)
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := Generate(cfg); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package gif
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+// A label changing form ("Seconds" to "Second") should only redraw that
+// label, not the whole canvas, or transparent timers redraw everything in
+// every frame.
+func TestLabelChangeRedrawsOnlyTheLabel(t *testing.T) {
+	for _, transition := range []string{"", TransitionFade} {
+		cfg := benchmarkConfig(40)
+		cfg.Transparent = true
+		cfg.Transition = transition
+		cfg.Frames = 10
+		cfg.Now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		cfg.EndTime = cfg.Now.Add(3 * time.Second) // 3, 2, 1, 0 seconds
+		if cfg.unitLabel(3, 2) == cfg.unitLabel(3, 1) {
+			t.Fatal("seconds label has no singular form")
+		}
+
+		a, err := Render(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		canvas := image.Rect(0, 0, a.Width, a.Height)
+		minutesRight := cfg.layout(cfg.columnDigits(cfg.frameValues(cfg.Now, 1))).colRects[2].Max.X
+
+		for i, f := range a.Frames[1:] {
+			r := f.Image.Rect
+			if r == canvas {
+				t.Fatalf("transition %q: frame %d redraws the whole canvas", transition, i+1)
+			}
+			// Only the seconds column and its label change
+			if r.Dx() > 1 && r.Min.X < minutesRight {
+				t.Errorf("transition %q: frame %d redraws %v, reaching the minutes column ending at x=%d", transition, i+1, r, minutesRight)
+			}
+		}
+	}
+}
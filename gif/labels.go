@@ -0,0 +1,301 @@
+package gif
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Label casing options.
+const (
+	LabelCaseUpper = "upper"
+	LabelCaseLower = "lower"
+	LabelCaseTitle = "title"
+)
+
+// Plural categories, as in the CLDR plural rules. Languages that do not
+// distinguish a category fall back to other.
+const (
+	pluralOne = iota
+	pluralFew
+	pluralMany
+	pluralOther
+)
+
+// unitForms are a unit's label in each plural category; empty entries fall
+// back to other.
+type unitForms [4]string
+
+type localeLabels struct {
+	plural func(n int) int
+	units  [4]unitForms // days, hours, minutes, seconds
+}
+
+func pluralOneOther(n int) int {
+	if n == 1 {
+		return pluralOne
+	}
+	return pluralOther
+}
+
+// French and Portuguese treat zero as singular too.
+func pluralZeroOneOther(n int) int {
+	if n == 0 || n == 1 {
+		return pluralOne
+	}
+	return pluralOther
+}
+
+func pluralNone(int) int {
+	return pluralOther
+}
+
+// Russian and Ukrainian: 1, 21, 31… / 2-4, 22-24… / everything else.
+func pluralEastSlavic(n int) int {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return pluralOne
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return pluralFew
+	default:
+		return pluralMany
+	}
+}
+
+func pluralPolish(n int) int {
+	switch {
+	case n == 1:
+		return pluralOne
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return pluralFew
+	default:
+		return pluralMany
+	}
+}
+
+func pluralCzech(n int) int {
+	switch {
+	case n == 1:
+		return pluralOne
+	case n >= 2 && n <= 4:
+		return pluralFew
+	default:
+		return pluralOther
+	}
+}
+
+// locales are the built-in label translations, keyed by language. The
+// bundled fonts have no CJK glyphs, so ja, zh and ko need a label font
+// that does.
+var locales = map[string]localeLabels{
+	"en": {pluralOneOther, [4]unitForms{
+		{pluralOne: "Day", pluralOther: "Days"},
+		{pluralOne: "Hour", pluralOther: "Hours"},
+		{pluralOne: "Minute", pluralOther: "Minutes"},
+		{pluralOne: "Second", pluralOther: "Seconds"},
+	}},
+	"es": {pluralOneOther, [4]unitForms{
+		{pluralOne: "Día", pluralOther: "Días"},
+		{pluralOne: "Hora", pluralOther: "Horas"},
+		{pluralOne: "Minuto", pluralOther: "Minutos"},
+		{pluralOne: "Segundo", pluralOther: "Segundos"},
+	}},
+	"fr": {pluralZeroOneOther, [4]unitForms{
+		{pluralOne: "Jour", pluralOther: "Jours"},
+		{pluralOne: "Heure", pluralOther: "Heures"},
+		{pluralOne: "Minute", pluralOther: "Minutes"},
+		{pluralOne: "Seconde", pluralOther: "Secondes"},
+	}},
+	"de": {pluralOneOther, [4]unitForms{
+		{pluralOne: "Tag", pluralOther: "Tage"},
+		{pluralOne: "Stunde", pluralOther: "Stunden"},
+		{pluralOne: "Minute", pluralOther: "Minuten"},
+		{pluralOne: "Sekunde", pluralOther: "Sekunden"},
+	}},
+	"it": {pluralOneOther, [4]unitForms{
+		{pluralOne: "Giorno", pluralOther: "Giorni"},
+		{pluralOne: "Ora", pluralOther: "Ore"},
+		{pluralOne: "Minuto", pluralOther: "Minuti"},
+		{pluralOne: "Secondo", pluralOther: "Secondi"},
+	}},
+	"pt": {pluralZeroOneOther, [4]unitForms{
+		{pluralOne: "Dia", pluralOther: "Dias"},
+		{pluralOne: "Hora", pluralOther: "Horas"},
+		{pluralOne: "Minuto", pluralOther: "Minutos"},
+		{pluralOne: "Segundo", pluralOther: "Segundos"},
+	}},
+	"nl": {pluralOneOther, [4]unitForms{
+		{pluralOne: "Dag", pluralOther: "Dagen"},
+		{pluralOne: "Uur", pluralOther: "Uur"},
+		{pluralOne: "Minuut", pluralOther: "Minuten"},
+		{pluralOne: "Seconde", pluralOther: "Seconden"},
+	}},
+	"sv": {pluralOneOther, [4]unitForms{
+		{pluralOne: "Dag", pluralOther: "Dagar"},
+		{pluralOne: "Timme", pluralOther: "Timmar"},
+		{pluralOne: "Minut", pluralOther: "Minuter"},
+		{pluralOne: "Sekund", pluralOther: "Sekunder"},
+	}},
+	"da": {pluralOneOther, [4]unitForms{
+		{pluralOne: "Dag", pluralOther: "Dage"},
+		{pluralOne: "Time", pluralOther: "Timer"},
+		{pluralOne: "Minut", pluralOther: "Minutter"},
+		{pluralOne: "Sekund", pluralOther: "Sekunder"},
+	}},
+	"nb": {pluralOneOther, [4]unitForms{
+		{pluralOne: "Dag", pluralOther: "Dager"},
+		{pluralOne: "Time", pluralOther: "Timer"},
+		{pluralOne: "Minutt", pluralOther: "Minutter"},
+		{pluralOne: "Sekund", pluralOther: "Sekunder"},
+	}},
+	"pl": {pluralPolish, [4]unitForms{
+		{pluralOne: "Dzień", pluralOther: "Dni"},
+		{pluralOne: "Godzina", pluralFew: "Godziny", pluralMany: "Godzin"},
+		{pluralOne: "Minuta", pluralFew: "Minuty", pluralMany: "Minut"},
+		{pluralOne: "Sekunda", pluralFew: "Sekundy", pluralMany: "Sekund"},
+	}},
+	"cs": {pluralCzech, [4]unitForms{
+		{pluralOne: "Den", pluralFew: "Dny", pluralOther: "Dní"},
+		{pluralOne: "Hodina", pluralFew: "Hodiny", pluralOther: "Hodin"},
+		{pluralOne: "Minuta", pluralFew: "Minuty", pluralOther: "Minut"},
+		{pluralOne: "Sekunda", pluralFew: "Sekundy", pluralOther: "Sekund"},
+	}},
+	"ru": {pluralEastSlavic, [4]unitForms{
+		{pluralOne: "День", pluralFew: "Дня", pluralMany: "Дней"},
+		{pluralOne: "Час", pluralFew: "Часа", pluralMany: "Часов"},
+		{pluralOne: "Минута", pluralFew: "Минуты", pluralMany: "Минут"},
+		{pluralOne: "Секунда", pluralFew: "Секунды", pluralMany: "Секунд"},
+	}},
+	"uk": {pluralEastSlavic, [4]unitForms{
+		{pluralOne: "День", pluralFew: "Дні", pluralMany: "Днів"},
+		{pluralOne: "Година", pluralFew: "Години", pluralMany: "Годин"},
+		{pluralOne: "Хвилина", pluralFew: "Хвилини", pluralMany: "Хвилин"},
+		{pluralOne: "Секунда", pluralFew: "Секунди", pluralMany: "Секунд"},
+	}},
+	"tr": {pluralNone, [4]unitForms{
+		{pluralOther: "Gün"},
+		{pluralOther: "Saat"},
+		{pluralOther: "Dakika"},
+		{pluralOther: "Saniye"},
+	}},
+	"ja": {pluralNone, [4]unitForms{
+		{pluralOther: "日"},
+		{pluralOther: "時間"},
+		{pluralOther: "分"},
+		{pluralOther: "秒"},
+	}},
+	"zh": {pluralNone, [4]unitForms{
+		{pluralOther: "天"},
+		{pluralOther: "小时"},
+		{pluralOther: "分钟"},
+		{pluralOther: "秒"},
+	}},
+	"ko": {pluralNone, [4]unitForms{
+		{pluralOther: "일"},
+		{pluralOther: "시간"},
+		{pluralOther: "분"},
+		{pluralOther: "초"},
+	}},
+}
+
+// localeLanguage reduces a locale code such as "de", "pt-BR" or "es_MX" to
+// its language.
+func localeLanguage(code string) string {
+	lang := strings.ToLower(code)
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	if lang == "no" || lang == "nn" {
+		lang = "nb"
+	}
+	return lang
+}
+
+// lookupLocale returns the labels for a locale code, or English if there
+// are none built in.
+func lookupLocale(code string) localeLabels {
+	if l, ok := locales[localeLanguage(code)]; ok {
+		return l
+	}
+	return locales["en"]
+}
+
+// ValidLocale reports whether code is empty or names a language with
+// built-in labels.
+func ValidLocale(code string) bool {
+	_, ok := locales[localeLanguage(code)]
+	return code == "" || ok
+}
+
+// ValidLabelCase reports whether name is a supported label casing.
+func ValidLabelCase(name string) bool {
+	switch name {
+	case "", LabelCaseUpper, LabelCaseLower, LabelCaseTitle:
+		return true
+	}
+	return false
+}
+
+func (f unitForms) form(category int) string {
+	if f[category] != "" {
+		return f[category]
+	}
+	return f[pluralOther]
+}
+
+// unitLabel returns the label for a unit (0=days … 3=seconds) showing value:
+// the custom label if set, otherwise the locale's plural form, then cased.
+func (c Config) unitLabel(unit, value int) string {
+	label := c.Labels[unit]
+	if label == "" {
+		l := lookupLocale(c.Locale)
+		label = l.units[unit].form(l.plural(value))
+	}
+	return applyCase(label, c.LabelCase)
+}
+
+// unitLabelForms returns every label a unit can show, for sizing.
+func (c Config) unitLabelForms(unit int) []string {
+	if c.Labels[unit] != "" {
+		return []string{applyCase(c.Labels[unit], c.LabelCase)}
+	}
+	var forms []string
+	for _, f := range lookupLocale(c.Locale).units[unit] {
+		if f != "" {
+			forms = append(forms, applyCase(f, c.LabelCase))
+		}
+	}
+	return forms
+}
+
+func applyCase(s, labelCase string) string {
+	switch labelCase {
+	case LabelCaseUpper:
+		return strings.ToUpper(s)
+	case LabelCaseLower:
+		return strings.ToLower(s)
+	case LabelCaseTitle:
+		return titleCase(s)
+	}
+	return s
+}
+
+// titleCase upper-cases the first letter of each word and lower-cases the
+// rest.
+func titleCase(s string) string {
+	var b strings.Builder
+	start := true
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '-' {
+			start = true
+			b.WriteRune(r)
+			continue
+		}
+		if start {
+			b.WriteRune(unicode.ToTitle(r))
+		} else {
+			b.WriteRune(unicode.ToLower(r))
+		}
+		start = false
+	}
+	return b.String()
+}
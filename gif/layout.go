@@ -0,0 +1,361 @@
+package gif
+
+import (
+	"image"
+	"math"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+// Layout modes for arranging the timer's units.
+const (
+	LayoutHorizontal = "horizontal" // one row of units, labels underneath
+	LayoutVertical   = "vertical"   // one unit per row, label to the right
+	LayoutGrid       = "grid"       // two units per row, labels underneath
+	LayoutInline     = "inline"     // a single line of text, e.g. 03d 04:12:55
+)
+
+// spritePad is the padding around the digits inside each sprite.
+const spritePad = 6.0
+
+// ValidLayout reports whether name is a supported layout. The empty string
+// is valid and means horizontal.
+func ValidLayout(name string) bool {
+	switch name {
+	case "", LayoutHorizontal, LayoutVertical, LayoutGrid, LayoutInline:
+		return true
+	}
+	return false
+}
+
+// layout is the geometry of a timer: where each column's sprite goes and
+// the static labels, text and separators drawn around them.
+type layout struct {
+	width, height int
+
+	colRects []image.Rectangle // sprite rectangle of each enabled column
+	labels   []placedText      // drawn with the label font; text is set per frame
+	texts    []placedText      // drawn with the number font
+	lines    [][4]float64      // separator segments x1, y1, x2, y2
+	lineW    float64
+
+	// numAlign places numbers narrower than their column: 0.5 centers
+	// them, 1 right-aligns them.
+	numAlign float64
+}
+
+// placedText is a string anchored at (x, y) as in gg.DrawStringAnchored.
+type placedText struct {
+	text   string
+	x, y   float64
+	ax, ay float64
+	sep    bool // drawn in the separator color
+	unit   int  // for labels, the unit (0=days … 3=seconds) labelled
+}
+
+// textBounds returns the pixels text covers when drawn at t with face, as
+// gg.DrawStringAnchored places it, with a pixel to spare for anti-aliasing.
+func (t placedText) textBounds(face font.Face, text string) image.Rectangle {
+	dc := gg.NewContext(1, 1)
+	dc.SetFontFace(face)
+	w, h := dc.MeasureString(text)
+	x, y := t.x-t.ax*w, t.y+t.ay*h
+	b, _ := font.BoundString(face, text)
+	return image.Rect(
+		int(math.Floor(x+float64(b.Min.X)/64))-1,
+		int(math.Floor(y+float64(b.Min.Y)/64))-1,
+		int(math.Ceil(x+float64(b.Max.X)/64))+1,
+		int(math.Ceil(y+float64(b.Max.Y)/64))+1,
+	)
+}
+
+// spriteHeight returns the height of number sprites for a face, along with
+// the measured height of its digits' line.
+func spriteHeight(numberFace font.Face) (h int, numH float64) {
+	dc := gg.NewContext(1, 1)
+	dc.SetFontFace(numberFace)
+	_, numH = dc.MeasureString("00")
+	return int(numH + spritePad*2), numH
+}
+
+// digitSlotWidth is the advance of the widest digit, the width each digit
+// of a column is given.
+func digitSlotWidth(numberFace font.Face) float64 {
+	var widest float64
+	for r := '0'; r <= '9'; r++ {
+		if advance, ok := numberFace.GlyphAdvance(r); ok {
+			widest = math.Max(widest, float64(advance)/64)
+		}
+	}
+	return widest
+}
+
+// layoutMetrics holds the spacing shared by every layout, scaled from the
+// number font size.
+type layoutMetrics struct {
+	fontSize float64
+	numH     float64 // height of a line of digits
+	slotW    float64 // width of one digit
+	spriteH  int
+	colPad   float64 // horizontal padding on each side of a column
+	sepGap   float64 // space between columns
+	topPad   float64 // padding above the numbers
+	labelGap float64 // space between a number and its label
+	labelH   float64 // height reserved for a label line
+
+	// Offsets from a sprite's top edge to the top of its digits and to
+	// their baseline.
+	digitTop, baseline float64
+}
+
+func (c Config) layoutMetrics() layoutMetrics {
+	fontSize := c.numberFontSizeVal()
+	numFace := truetype.NewFace(GetFont(c.NumberFontName), &truetype.Options{Size: fontSize})
+	spriteH, numH := spriteHeight(numFace)
+
+	m := layoutMetrics{
+		fontSize: fontSize,
+		numH:     numH,
+		slotW:    digitSlotWidth(numFace),
+		spriteH:  spriteH,
+		colPad:   math.Max(fontSize*0.25, 6),
+		sepGap:   math.Max(fontSize*0.03, 1),
+		topPad:   math.Max(fontSize*0.35, 12),
+	}
+	digitBounds, _ := font.BoundString(numFace, "00")
+	m.baseline = float64(spriteH)/2 + numH/2
+	m.digitTop = m.baseline + float64(digitBounds.Min.Y)/64
+
+	if c.ShowLabels {
+		m.labelGap = math.Max(fontSize*0.08, 3)
+		m.labelH = c.labelFontSizeVal() * 1.3
+	}
+	return m
+}
+
+// numWidth is the width of n digits.
+func (m layoutMetrics) numWidth(n int) float64 {
+	return m.slotW * float64(n)
+}
+
+// spriteWidth is the width of the sprite for a column n digits wide.
+func (m layoutMetrics) spriteWidth(n int) int {
+	return int(m.numWidth(n) + spritePad*2)
+}
+
+// layout computes the geometry for the configured layout mode, given how
+// many digits wide each enabled column is.
+func (c Config) layout(digits []int) layout {
+	m := c.layoutMetrics()
+	cols := c.enabledColumns()
+
+	var l layout
+	switch c.Layout {
+	case LayoutVertical:
+		l = c.verticalLayout(m, cols, digits)
+	case LayoutGrid:
+		l = c.gridLayout(m, cols, digits)
+	case LayoutInline:
+		l = c.inlineLayout(m, cols, digits)
+	default:
+		l = c.horizontalLayout(m, cols, digits)
+	}
+	if l.numAlign == 0 {
+		l.numAlign = 0.5
+	}
+	l.lineW = math.Max(1.5, m.fontSize*0.04)
+	return l
+}
+
+// cell places the sprite and label for one column whose number is centered
+// on cx with its sprite top at y.
+func (c Config) cell(l *layout, m layoutMetrics, colIdx int, cx, y float64, spriteW int) {
+	pasteX := int(cx) - spriteW/2
+	l.colRects = append(l.colRects, image.Rect(pasteX, int(y), pasteX+spriteW, int(y)+m.spriteH))
+	if c.ShowLabels {
+		labelY := y + float64(m.spriteH) + m.labelGap + c.labelFontSizeVal()*0.5
+		l.labels = append(l.labels, placedText{unit: colIdx, x: cx, y: labelY, ax: 0.5, ay: 0.5})
+	}
+}
+
+// verticalSeparator adds the short line drawn between two numbers, centered
+// at x beside a sprite whose top is at y.
+func (c Config) verticalSeparator(l *layout, m layoutMetrics, x, y float64) {
+	if !c.ShowSeparators {
+		return
+	}
+	sepHeight := m.fontSize * 0.6
+	sepOffsetY := 10.0 // push separator down for alignment
+	centerY := y + float64(m.spriteH)/2
+	l.lines = append(l.lines, [4]float64{x, centerY - sepHeight/2 + sepOffsetY, x, centerY + sepHeight/2 + sepOffsetY})
+}
+
+func (c Config) horizontalLayout(m layoutMetrics, cols []int, digits []int) layout {
+	l := layout{
+		height: int(math.Ceil(m.topPad + m.numH + m.labelGap + m.labelH + m.topPad)),
+	}
+	x := 0.0
+	for i, colIdx := range cols {
+		if i > 0 {
+			c.verticalSeparator(&l, m, x+m.sepGap/2, m.topPad)
+			x += m.sepGap
+		}
+		columnWidth := m.numWidth(digits[i]) + m.colPad*2
+		c.cell(&l, m, colIdx, x+columnWidth/2, m.topPad, m.spriteWidth(digits[i]))
+		x += columnWidth
+	}
+	l.width = int(math.Ceil(x))
+	return l
+}
+
+func (c Config) verticalLayout(m layoutMetrics, cols []int, digits []int) layout {
+	pad := m.colPad
+	rowGap := math.Max(m.fontSize*0.2, 8)
+
+	labelW, labelGap := 0.0, 0.0
+	if c.ShowLabels {
+		labelFace := truetype.NewFace(GetFont(c.LabelFontName), &truetype.Options{Size: c.labelFontSizeVal()})
+		dc := gg.NewContext(1, 1)
+		dc.SetFontFace(labelFace)
+		for _, colIdx := range cols {
+			for _, label := range c.unitLabelForms(colIdx) {
+				w, _ := dc.MeasureString(label)
+				labelW = math.Max(labelW, w)
+			}
+		}
+		labelGap = math.Max(m.fontSize*0.1, 4)
+	}
+
+	// Numbers are right-aligned so their digits line up
+	spriteW := 0
+	for _, n := range digits {
+		spriteW = max(spriteW, m.spriteWidth(n))
+	}
+
+	n := float64(len(cols))
+	l := layout{
+		width:  int(math.Ceil(pad + float64(spriteW) + labelGap + labelW + pad)),
+		height: int(math.Ceil(pad*2 + float64(m.spriteH)*n + rowGap*(n-1))),
+	}
+	for i, colIdx := range cols {
+		y := pad + float64(i)*(float64(m.spriteH)+rowGap)
+		right := int(pad) + spriteW
+		l.colRects = append(l.colRects, image.Rect(right-m.spriteWidth(digits[i]), int(y), right, int(y)+m.spriteH))
+		if c.ShowLabels {
+			// Labels sit on the digits' baseline
+			l.labels = append(l.labels, placedText{
+				unit: colIdx,
+				x:    pad + float64(spriteW) + labelGap,
+				y:    y + m.baseline,
+			})
+		}
+		if i > 0 && c.ShowSeparators {
+			// Sprites are opaque, so the line has to stay in the gap
+			sepY := y - rowGap/2
+			l.lines = append(l.lines, [4]float64{pad, sepY, float64(l.width) - pad, sepY})
+		}
+	}
+	return l
+}
+
+func (c Config) gridLayout(m layoutMetrics, cols []int, digits []int) layout {
+	// Every cell is as wide as the widest column, to keep the grid aligned
+	maxDigits := 0
+	for _, n := range digits {
+		maxDigits = max(maxDigits, n)
+	}
+	columnWidth := m.numWidth(maxDigits) + m.colPad*2
+	cellH := m.numH + m.labelGap + m.labelH
+	// Rows are spaced by the sprite padding too, since sprites (and the
+	// labels placed below them) extend that far past numH.
+	rowGap := m.topPad + spritePad*2
+
+	// Bottom of a row's content relative to its top: the labels, or the
+	// digits' baseline without them.
+	rowBottom := m.baseline
+	if c.ShowLabels {
+		rowBottom = float64(m.spriteH) + m.labelGap + c.labelFontSizeVal()
+	}
+
+	perRow := 2
+	if len(cols) < perRow {
+		perRow = len(cols)
+	}
+	rows := (len(cols) + perRow - 1) / perRow
+	rowWidth := columnWidth*float64(perRow) + m.sepGap*float64(perRow-1)
+
+	l := layout{
+		width:  int(math.Ceil(rowWidth)),
+		height: int(math.Ceil(m.topPad*2 + cellH*float64(rows) + rowGap*float64(rows-1))),
+	}
+	for i, colIdx := range cols {
+		row, pos := i/perRow, i%perRow
+		y := m.topPad + float64(row)*(cellH+rowGap)
+
+		// Center a partly filled last row
+		inRow := perRow
+		if remaining := len(cols) - row*perRow; remaining < perRow {
+			inRow = remaining
+		}
+		offset := (rowWidth - (columnWidth*float64(inRow) + m.sepGap*float64(inRow-1))) / 2
+
+		x := offset + float64(pos)*(columnWidth+m.sepGap)
+		c.cell(&l, m, colIdx, x+columnWidth/2, y, m.spriteWidth(digits[i]))
+		if pos > 0 {
+			c.verticalSeparator(&l, m, x-m.sepGap/2, y)
+		}
+		if row > 0 && pos == 0 && c.ShowSeparators {
+			prevY := y - cellH - rowGap
+			// Halfway between the row above and these digits, but clear of
+			// the sprites, which are opaque
+			sepY := math.Min((prevY+rowBottom+y+m.digitTop)/2, y-math.Max(1.5, m.fontSize*0.04))
+			l.lines = append(l.lines, [4]float64{m.colPad, sepY, float64(l.width) - m.colPad, sepY})
+		}
+	}
+	return l
+}
+
+// inlineLayout lays the units out as one line of text: days get a "d"
+// suffix and the remaining units are joined by colons. Labels and separator
+// lines are not drawn.
+func (c Config) inlineLayout(m layoutMetrics, cols []int, digits []int) layout {
+	numFace := truetype.NewFace(GetFont(c.NumberFontName), &truetype.Options{Size: m.fontSize})
+	dc := gg.NewContext(1, 1)
+	dc.SetFontFace(numFace)
+	measure := func(s string) float64 {
+		w, _ := dc.MeasureString(s)
+		return w
+	}
+
+	padX := m.colPad
+	padY := math.Max(m.fontSize*0.15, 6)
+	centerY := padY + float64(m.spriteH)/2
+
+	// Right-aligned, so a number losing a digit leaves a gap before it
+	// rather than a space either side
+	l := layout{numAlign: 1}
+	x := padX
+	for i, colIdx := range cols {
+		if i > 0 && cols[i-1] != 0 {
+			l.texts = append(l.texts, placedText{text: ":", x: x, y: centerY, ay: 0.5, sep: true})
+			x += measure(":")
+		} else if i > 0 {
+			x += measure(" ")
+		}
+
+		spriteW := m.spriteWidth(digits[i])
+		l.colRects = append(l.colRects, image.Rect(int(x), int(padY), int(x)+spriteW, int(padY)+m.spriteH))
+		x = float64(int(x) + spriteW)
+
+		if colIdx == 0 {
+			l.texts = append(l.texts, placedText{text: "d", x: x, y: centerY, ay: 0.5})
+			x += measure("d")
+		}
+	}
+
+	l.width = int(math.Ceil(x + padX))
+	l.height = int(math.Ceil(padY*2 + float64(m.spriteH)))
+	return l
+}
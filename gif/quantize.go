@@ -0,0 +1,357 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// colorBox is a set of colors and the range each channel spans in it.
+type colorBox struct {
+	colors []color.RGBA
+	lo, hi [3]uint8
+}
+
+func newColorBox(colors []color.RGBA) colorBox {
+	b := colorBox{colors: colors, lo: [3]uint8{255, 255, 255}}
+	for _, c := range colors {
+		for i, v := range [3]uint8{c.R, c.G, c.B} {
+			b.lo[i] = min(b.lo[i], v)
+			b.hi[i] = max(b.hi[i], v)
+		}
+	}
+	return b
+}
+
+// widest returns the channel with the largest range and that range.
+func (b colorBox) widest() (channel int, span int) {
+	for i := range b.lo {
+		if s := int(b.hi[i]) - int(b.lo[i]); s > span {
+			channel, span = i, s
+		}
+	}
+	return channel, span
+}
+
+// average is the mean color of the box.
+func (b colorBox) average() color.RGBA {
+	var r, g, bl int
+	for _, c := range b.colors {
+		r += int(c.R)
+		g += int(c.G)
+		bl += int(c.B)
+	}
+	n := len(b.colors)
+	return color.RGBA{R: uint8((r + n/2) / n), G: uint8((g + n/2) / n), B: uint8((bl + n/2) / n), A: 255}
+}
+
+// medianCut reduces colors to at most n representatives. The box whose
+// widest channel range, weighted by how many colors it holds, is largest is
+// split at its median along that channel until there are n boxes; each box
+// is then represented by its average. colors is reordered.
+func medianCut(colors []color.RGBA, n int) []color.RGBA {
+	if len(colors) == 0 || n <= 0 {
+		return nil
+	}
+
+	boxes := []colorBox{newColorBox(colors)}
+	for len(boxes) < n {
+		best, bestScore := -1, 0
+		for i, b := range boxes {
+			if _, span := b.widest(); span > 0 && len(b.colors) > 1 {
+				if score := span * len(b.colors); score > bestScore {
+					best, bestScore = i, score
+				}
+			}
+		}
+		if best < 0 {
+			break // every box holds a single color
+		}
+
+		b := boxes[best]
+		channel, _ := b.widest()
+		sort.Slice(b.colors, func(i, j int) bool {
+			return channelOf(b.colors[i], channel) < channelOf(b.colors[j], channel)
+		})
+		// Split between distinct values nearest the median, so a color
+		// repeated across the median is not averaged with its neighbors
+		mid := len(b.colors) / 2
+		v := channelOf(b.colors[mid], channel)
+		lo, hi := mid, mid
+		for lo > 0 && channelOf(b.colors[lo-1], channel) == v {
+			lo--
+		}
+		for hi < len(b.colors) && channelOf(b.colors[hi], channel) == v {
+			hi++
+		}
+		switch {
+		case lo == 0:
+			mid = hi
+		case hi == len(b.colors):
+			mid = lo
+		case hi-mid < mid-lo:
+			mid = hi
+		default:
+			mid = lo
+		}
+		boxes[best] = newColorBox(b.colors[:mid])
+		boxes = append(boxes, newColorBox(b.colors[mid:]))
+	}
+
+	out := make([]color.RGBA, len(boxes))
+	for i, b := range boxes {
+		out[i] = b.average()
+	}
+	return out
+}
+
+func channelOf(c color.RGBA, channel int) uint8 {
+	switch channel {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
+
+// edgeSteps is how many shades anti-aliased edges get between the
+// background and an ink color. More cost file size for little visible gain.
+const edgeSteps = 8
+
+// palette builds the frame palette, at most 256 entries: the transparent
+// entry (always index 0) when frames contain transparency, the ink colors
+// and flat background exactly, then the background and the ink's
+// anti-aliased edges over it reduced by median cut. backdrop is the
+// gradient or image background, or nil for a flat one.
+func (c Config) palette(backdrop *image.RGBA, ink ...color.Color) []color.Color {
+	var palette []color.Color
+	if c.hasTransparency() {
+		palette = append(palette, color.Transparent)
+	}
+
+	// grounds are what anti-aliased edges blend toward: the background, or
+	// the matte for transparent timers
+	var grounds []color.RGBA
+	if backdrop != nil {
+		grounds = sampleBackdrop(backdrop)
+	} else {
+		ground := c.Background
+		if c.Transparent {
+			ground = c.matteColorVal()
+		}
+		ink = append([]color.Color{ground}, ink...)
+		grounds = []color.RGBA{rgbaOf(ground)}
+	}
+
+	if c.hasTransparency() && !c.Transparent {
+		// Rounded corners blend the background into the matte
+		ink = append(ink, c.matteColorVal())
+	}
+	var inks []color.RGBA
+	for _, ic := range ink {
+		if ic == nil {
+			continue
+		}
+		palette = append(palette, rgbaOf(ic))
+		inks = append(inks, rgbaOf(ic))
+	}
+
+	samples := append([]color.RGBA(nil), grounds...)
+	for i, g := range grounds {
+		if len(grounds) > 1 && i%16 != 0 {
+			continue
+		}
+		for _, ic := range inks {
+			for s := 1; s < edgeSteps; s++ {
+				samples = append(samples, mixRGBA(g, ic, float64(s)/edgeSteps))
+			}
+		}
+	}
+
+	for _, pc := range medianCut(samples, 256-len(palette)) {
+		palette = append(palette, pc)
+	}
+	return palette
+}
+
+// sampleBackdrop returns at most about 64K of the backdrop's pixels, evenly
+// spread.
+func sampleBackdrop(backdrop *image.RGBA) []color.RGBA {
+	pix := backdrop.Rect.Dx() * backdrop.Rect.Dy()
+	stride := max(1, int(math.Sqrt(float64(pix)/65536)))
+	var samples []color.RGBA
+	for y := backdrop.Rect.Min.Y; y < backdrop.Rect.Max.Y; y += stride {
+		for x := backdrop.Rect.Min.X; x < backdrop.Rect.Max.X; x += stride {
+			samples = append(samples, backdrop.RGBAAt(x, y))
+		}
+	}
+	return samples
+}
+
+func rgbaOf(c color.Color) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+func mixRGBA(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 { return uint8(math.Round(float64(x)*(1-t) + float64(y)*t)) }
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 255}
+}
+
+// lutBits is the precision per channel of the quantizer's lookup table.
+const lutBits = 5
+
+// quantizer maps images onto a palette. Palette colors map to themselves;
+// any other color goes through a lookup table of the nearest entry per
+// cell of the color cube, filled in as cells are first hit.
+type quantizer struct {
+	palette     color.Palette
+	colors      []color.RGBA
+	transparent int // index of the transparent entry, or -1
+	matte       color.RGBA
+	dither      bool
+
+	exact map[color.RGBA]uint8
+	cells []atomic.Int32 // nearest index + 1; 0 until looked up
+}
+
+// newQuantizer prepares palette for quantizing. Partially transparent pixels
+// are blended over matte; with dither, the error of each pixel is spread to
+// its neighbors (Floyd–Steinberg).
+func newQuantizer(palette []color.Color, matte color.Color, dither bool) *quantizer {
+	q := &quantizer{
+		palette:     palette,
+		colors:      make([]color.RGBA, len(palette)),
+		transparent: -1,
+		matte:       rgbaOf(matte),
+		dither:      dither,
+		exact:       make(map[color.RGBA]uint8, len(palette)),
+		cells:       make([]atomic.Int32, 1<<(3*lutBits)),
+	}
+	for i := len(palette) - 1; i >= 0; i-- {
+		c := rgbaOf(palette[i])
+		q.colors[i] = c
+		if c.A == 0 {
+			q.transparent = i
+			continue
+		}
+		q.exact[c] = uint8(i) // the first of duplicates wins
+	}
+	return q
+}
+
+// bytes approximates the memory the quantizer holds, mostly its table.
+func (q *quantizer) bytes() int64 {
+	return int64(len(q.cells)*4 + len(q.colors)*(4+spriteItemOverhead))
+}
+
+// index returns the palette entry for an opaque color.
+func (q *quantizer) index(c color.RGBA) uint8 {
+	if i, ok := q.exact[c]; ok {
+		return i
+	}
+	const shift = 8 - lutBits
+	cell := int(c.R>>shift)<<(2*lutBits) | int(c.G>>shift)<<lutBits | int(c.B>>shift)
+	if v := q.cells[cell].Load(); v > 0 {
+		return uint8(v - 1)
+	}
+
+	// Match the middle of the cell, so every color in it gets the same entry
+	const half = 1 << (shift - 1)
+	center := color.RGBA{R: c.R>>shift<<shift | half, G: c.G>>shift<<shift | half, B: c.B>>shift<<shift | half}
+	i := q.nearest(int(center.R), int(center.G), int(center.B))
+	q.cells[cell].Store(int32(i) + 1)
+	return i
+}
+
+// nearest scans the palette for the opaque entry closest to r, g, b.
+func (q *quantizer) nearest(r, g, b int) uint8 {
+	best, bestDist := 0, math.MaxInt
+	for i, pc := range q.colors {
+		if i == q.transparent {
+			continue
+		}
+		dr, dg, db := r-int(pc.R), g-int(pc.G), b-int(pc.B)
+		if dist := dr*dr + dg*dg + db*db; dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return uint8(best)
+}
+
+// quantize maps the bounds part of src onto the palette. Pixels under half
+// opacity become the transparent entry, if there is one; other partially
+// transparent pixels are blended over the matte first, so anti-aliased
+// edges fade toward the background the image will sit on.
+func (q *quantizer) quantize(src image.Image, bounds image.Rectangle) *image.Paletted {
+	dst := image.NewPaletted(bounds, q.palette)
+	rgba, _ := src.(*image.RGBA)
+
+	// Floyd–Steinberg error for the current and next row, per channel,
+	// offset by one so x-1 and x+1 stay in range
+	var cur, next [][3]int
+	if q.dither {
+		cur = make([][3]int, bounds.Dx()+2)
+		next = make([][3]int, bounds.Dx()+2)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := dst.Pix[dst.PixOffset(bounds.Min.X, y):]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var c color.RGBA
+			if rgba != nil {
+				c = rgba.RGBAAt(x, y)
+			} else {
+				c = rgbaOf(src.At(x, y))
+			}
+
+			if c.A < 0x80 && q.transparent >= 0 {
+				row[x-bounds.Min.X] = uint8(q.transparent)
+				continue
+			}
+			if c.A < 0xff {
+				// Colors are premultiplied, so blending is one multiply-add
+				inv := 0xff - int(c.A)
+				c.R += uint8((int(q.matte.R)*inv + 0x7f) / 0xff)
+				c.G += uint8((int(q.matte.G)*inv + 0x7f) / 0xff)
+				c.B += uint8((int(q.matte.B)*inv + 0x7f) / 0xff)
+			}
+			c.A = 0xff
+
+			if !q.dither {
+				row[x-bounds.Min.X] = q.index(c)
+				continue
+			}
+
+			i := x - bounds.Min.X + 1
+			want := [3]int{
+				clamp8(int(c.R) + cur[i][0]/16),
+				clamp8(int(c.G) + cur[i][1]/16),
+				clamp8(int(c.B) + cur[i][2]/16),
+			}
+			idx := q.index(color.RGBA{R: uint8(want[0]), G: uint8(want[1]), B: uint8(want[2]), A: 0xff})
+			row[x-bounds.Min.X] = idx
+
+			got := q.colors[idx]
+			for ch, v := range [3]uint8{got.R, got.G, got.B} {
+				e := want[ch] - int(v)
+				cur[i+1][ch] += e * 7
+				next[i-1][ch] += e * 3
+				next[i][ch] += e * 5
+				next[i+1][ch] += e
+			}
+		}
+		if q.dither {
+			cur, next = next, cur
+			clear(next)
+		}
+	}
+
+	return dst
+}
+
+func clamp8(v int) int {
+	return min(max(v, 0), 255)
+}
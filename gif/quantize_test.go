@@ -0,0 +1,69 @@
+package gif
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuantizePaletteColorsMapToThemselves(t *testing.T) {
+	palette := []color.Color{
+		color.Transparent,
+		color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		color.RGBA{A: 255},
+		color.RGBA{R: 17, G: 34, B: 51, A: 255},
+		color.RGBA{R: 18, G: 34, B: 51, A: 255}, // in the same lookup cell as the one before
+		color.RGBA{R: 255, G: 87, B: 51, A: 255},
+	}
+	src := image.NewRGBA(image.Rect(0, 0, len(palette)-1, 3))
+	for y := 0; y < 3; y++ {
+		for x := range len(palette) - 1 {
+			src.Set(x, y, palette[(x+y)%(len(palette)-1)+1])
+		}
+	}
+
+	for _, dither := range []bool{false, true} {
+		q := newQuantizer(palette, color.White, dither)
+		dst := q.quantize(src, src.Rect)
+		for y := 0; y < 3; y++ {
+			for x := range len(palette) - 1 {
+				if want := (x+y)%(len(palette)-1) + 1; int(dst.ColorIndexAt(x, y)) != want {
+					t.Errorf("dither %v: pixel %d,%d is entry %d, want %d", dither, x, y, dst.ColorIndexAt(x, y), want)
+				}
+			}
+		}
+	}
+}
+
+func TestQuantizeKeepsTwoColors(t *testing.T) {
+	a := color.RGBA{R: 200, G: 30, B: 90, A: 255}
+	b := color.RGBA{R: 20, G: 180, B: 240, A: 255}
+	src := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	var colors []color.RGBA
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			c := a
+			if (x/3+y/5)%2 == 1 {
+				c = b
+			}
+			src.SetRGBA(x, y, c)
+			colors = append(colors, c)
+		}
+	}
+
+	reduced := medianCut(colors, 8)
+	if len(reduced) != 2 {
+		t.Fatalf("median cut kept %d colors, want 2", len(reduced))
+	}
+	palette := []color.Color{reduced[0], reduced[1]}
+	for _, dither := range []bool{false, true} {
+		dst := newQuantizer(palette, color.White, dither).quantize(src, src.Rect)
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				if got := rgbaOf(dst.At(x, y)); got != src.RGBAAt(x, y) {
+					t.Fatalf("dither %v: pixel %d,%d is %v, want %v", dither, x, y, got, src.RGBAAt(x, y))
+				}
+			}
+		}
+	}
+}
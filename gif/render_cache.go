@@ -0,0 +1,132 @@
+package gif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// RenderCache sits in front of GenerateFormat and shares encoded images
+// between requests that render the same config in the same format within the
+// same wall-clock second.
+// Concurrent misses for the same key are coalesced into a single encode.
+type RenderCache struct {
+	mu      sync.Mutex
+	entries map[string]renderEntry
+	group   singleflight.Group
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	coalesced atomic.Uint64
+}
+
+type renderEntry struct {
+	data   []byte
+	second int64
+}
+
+// RenderCacheStats is a snapshot of the cache counters.
+type RenderCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Coalesced uint64 `json:"coalesced"`
+	Entries   int    `json:"entries"`
+}
+
+func NewRenderCache() *RenderCache {
+	return &RenderCache{
+		entries: make(map[string]renderEntry),
+	}
+}
+
+// Generate returns cfg encoded in format, rendered as of the start of the
+// current second (or of cfg.Now, if set).
+func (c *RenderCache) Generate(cfg Config, format Format) ([]byte, error) {
+	now := cfg.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	cfg.Now = now.Truncate(time.Second)
+	second := cfg.Now.Unix()
+	if !cfg.EndTime.IsZero() {
+		cfg.EndTime = cfg.Now.Add(cfg.EndTime.Sub(cfg.Now).Truncate(cfg.remainingStep()))
+	}
+	key := renderKey(cfg, format)
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return e.data, nil
+	}
+	c.mu.Unlock()
+
+	rendered := false
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		rendered = true
+		data, err := GenerateFormat(cfg, format)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		// Entries are only useful for the second they were rendered in.
+		for k, e := range c.entries {
+			if e.second < second {
+				delete(c.entries, k)
+			}
+		}
+		c.entries[key] = renderEntry{data: data, second: second}
+		c.mu.Unlock()
+
+		return data, nil
+	})
+	if rendered {
+		c.misses.Add(1)
+	} else {
+		c.coalesced.Add(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]byte), nil
+}
+
+// Stats returns the current hit, miss and coalesced counts.
+func (c *RenderCache) Stats() RenderCacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return RenderCacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Coalesced: c.coalesced.Load(),
+		Entries:   entries,
+	}
+}
+
+// remainingStep is the precision the time remaining is shown to. Frames are
+// a frame delay apart and show whole seconds, so end times that differ by
+// less than the greatest common divisor of the two render the same frames.
+func (c Config) remainingStep() time.Duration {
+	a, b := c.frameDelay()*10, 1000 // milliseconds
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return time.Duration(a) * time.Millisecond
+}
+
+// renderKey hashes every field of cfg, including the truncated Now and
+// EndTime, and the format.
+func renderKey(cfg Config, format Format) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %#v", format, cfg)
+	return hex.EncodeToString(h.Sum(nil))
+}
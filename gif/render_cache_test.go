@@ -0,0 +1,35 @@
+package gif
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderCacheSharesSubsecondEndTimes(t *testing.T) {
+	c := NewRenderCache()
+	cfg := benchmarkConfig(20)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		cfg.Now = now.Add(time.Duration(i) * 100 * time.Millisecond)
+		cfg.EndTime = cfg.Now.Add(time.Hour)
+		if _, err := c.Generate(cfg, FormatGIF); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := c.Stats(); s.Misses != 1 || s.Hits != 2 {
+		t.Errorf("stats = %+v, want 1 miss and 2 hits", s)
+	}
+}
+
+func TestRemainingStep(t *testing.T) {
+	for delay, want := range map[int]time.Duration{
+		0:   time.Second,
+		50:  500 * time.Millisecond,
+		30:  100 * time.Millisecond,
+		250: 500 * time.Millisecond,
+	} {
+		if got := (Config{FrameDelay: delay}).remainingStep(); got != want {
+			t.Errorf("remainingStep with delay %d = %v, want %v", delay, got, want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package gif
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// SpriteCacheLimits bounds the sprite cache. Zero values mean no limit.
+type SpriteCacheLimits struct {
+	MaxEntries int
+	MaxBytes   int64
+	TTL        time.Duration // entries unused for this long are dropped
+}
+
+// DefaultSpriteCacheLimits are used until SetSpriteCacheLimits is called.
+var DefaultSpriteCacheLimits = SpriteCacheLimits{
+	MaxEntries: 256,
+	MaxBytes:   64 << 20,
+}
+
+// SpriteCacheStats is a snapshot of the sprite cache counters.
+type SpriteCacheStats struct {
+	Entries     int     `json:"entries"`
+	Bytes       int64   `json:"bytes"`
+	Hits        uint64  `json:"hits"`
+	Misses      uint64  `json:"misses"`
+	Coalesced   uint64  `json:"coalesced"`
+	Evictions   uint64  `json:"evictions"`
+	Expirations uint64  `json:"expirations"`
+	HitRate     float64 `json:"hit_rate"`
+}
+
+// spriteLRU holds sprite caches, least recently used at the back of ll.
+// Concurrent misses for the same key share a single build.
+type spriteLRU struct {
+	mu     sync.Mutex
+	limits SpriteCacheLimits
+	ll     *list.List
+	items  map[cacheKey]*list.Element
+	group  singleflight.Group
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	coalesced   atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+type spriteEntry struct {
+	key      cacheKey
+	cache    *spriteCache
+	lastUsed time.Time
+}
+
+var spriteCaches = newSpriteLRU(DefaultSpriteCacheLimits)
+
+func newSpriteLRU(limits SpriteCacheLimits) *spriteLRU {
+	return &spriteLRU{
+		limits: limits,
+		ll:     list.New(),
+		items:  make(map[cacheKey]*list.Element),
+	}
+}
+
+// SetSpriteCacheLimits changes the sprite cache bounds, evicting entries
+// as needed to meet them.
+func SetSpriteCacheLimits(limits SpriteCacheLimits) {
+	spriteCaches.mu.Lock()
+	spriteCaches.limits = limits
+	spriteCaches.prune(time.Now())
+	spriteCaches.mu.Unlock()
+}
+
+// GetSpriteCacheStats returns the current sprite cache counters.
+func GetSpriteCacheStats() SpriteCacheStats {
+	return spriteCaches.stats()
+}
+
+// get returns the cached sprites for key, calling build on a miss. The
+// bool reports whether it was a hit.
+func (c *spriteLRU) get(key cacheKey, build func() *spriteCache) (*spriteCache, bool) {
+	now := time.Now()
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*spriteEntry)
+		if c.limits.TTL > 0 && now.Sub(e.lastUsed) > c.limits.TTL {
+			c.remove(el)
+			c.expirations.Add(1)
+		} else {
+			e.lastUsed = now
+			c.ll.MoveToFront(el)
+			if c.limits.MaxBytes > 0 {
+				// Entries grow as numbers are composed, so re-check the
+				// byte limit even when nothing new was added.
+				c.prune(now)
+			}
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return e.cache, true
+		}
+	}
+	c.mu.Unlock()
+
+	built, found := false, false
+	v, _, _ := c.group.Do(fmt.Sprintf("%#v", key), func() (interface{}, error) {
+		// A build that finished just before this call began has already
+		// stored its entry.
+		c.mu.Lock()
+		if el, ok := c.items[key]; ok {
+			c.mu.Unlock()
+			found = true
+			return el.Value.(*spriteEntry).cache, nil
+		}
+		c.mu.Unlock()
+
+		built = true
+		cache := build()
+
+		c.mu.Lock()
+		c.items[key] = c.ll.PushFront(&spriteEntry{key: key, cache: cache, lastUsed: time.Now()})
+		c.prune(time.Now())
+		c.mu.Unlock()
+
+		return cache, nil
+	})
+	switch {
+	case built:
+		c.misses.Add(1)
+	case found:
+		c.hits.Add(1)
+		return v.(*spriteCache), true
+	default:
+		c.coalesced.Add(1)
+	}
+	return v.(*spriteCache), false
+}
+
+// prune drops expired entries, then least recently used ones until the
+// cache is within its limits. The most recent entry is always kept. Callers
+// hold c.mu.
+func (c *spriteLRU) prune(now time.Time) {
+	if c.limits.TTL > 0 {
+		for el := c.ll.Back(); el != nil && el != c.ll.Front(); {
+			prev := el.Prev()
+			if now.Sub(el.Value.(*spriteEntry).lastUsed) > c.limits.TTL {
+				c.remove(el)
+				c.expirations.Add(1)
+			}
+			el = prev
+		}
+	}
+
+	size := c.bytes()
+	for c.ll.Len() > 1 {
+		overEntries := c.limits.MaxEntries > 0 && c.ll.Len() > c.limits.MaxEntries
+		overBytes := c.limits.MaxBytes > 0 && size > c.limits.MaxBytes
+		if !overEntries && !overBytes {
+			break
+		}
+		el := c.ll.Back()
+		size -= el.Value.(*spriteEntry).cache.size.Load()
+		c.remove(el)
+		c.evictions.Add(1)
+	}
+}
+
+// forget drops every entry whose key matches, e.g. all those built from a
+// deleted font.
+func (c *spriteLRU) forget(match func(cacheKey) bool) {
+	c.mu.Lock()
+	for el := c.ll.Front(); el != nil; {
+		next := el.Next()
+		if match(el.Value.(*spriteEntry).key) {
+			c.remove(el)
+		}
+		el = next
+	}
+	c.mu.Unlock()
+}
+
+func (c *spriteLRU) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*spriteEntry).key)
+}
+
+// bytes sums the entries' sizes, which grow as numbers are composed.
+// Callers hold c.mu.
+func (c *spriteLRU) bytes() int64 {
+	var total int64
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		total += el.Value.(*spriteEntry).cache.size.Load()
+	}
+	return total
+}
+
+func (c *spriteLRU) stats() SpriteCacheStats {
+	c.mu.Lock()
+	entries := c.ll.Len()
+	size := c.bytes()
+	c.mu.Unlock()
+
+	s := SpriteCacheStats{
+		Entries:     entries,
+		Bytes:       size,
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Coalesced:   c.coalesced.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+	if lookups := s.Hits + s.Misses + s.Coalesced; lookups > 0 {
+		s.HitRate = float64(s.Hits+s.Coalesced) / float64(lookups)
+	}
+	return s
+}
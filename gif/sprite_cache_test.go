@@ -0,0 +1,86 @@
+package gif
+
+import (
+	"image"
+	"sync"
+	"testing"
+)
+
+func TestSpriteLRUKeepsOneEntryPerKey(t *testing.T) {
+	c := newSpriteLRU(SpriteCacheLimits{MaxEntries: 2})
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := cacheKey{NumberFontSize: float64(i % 3)}
+			c.get(key, func() *spriteCache { return &spriteCache{} })
+		}(i)
+	}
+	wg.Wait()
+
+	if len(c.items) != c.ll.Len() {
+		t.Fatalf("%d keys for %d entries", len(c.items), c.ll.Len())
+	}
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		if c.items[el.Value.(*spriteEntry).key] != el {
+			t.Fatal("entry not indexed by its key")
+		}
+	}
+}
+
+func TestSpriteCacheResetsAtItemLimit(t *testing.T) {
+	c := &spriteCache{baseSize: 100}
+	c.size.Store(c.baseSize)
+	for i := 0; i < maxSpriteItems; i++ {
+		c.remember(&c.diffs, i, image.Rectangle{}, 0)
+	}
+	if got := c.items.Load(); got != maxSpriteItems {
+		t.Fatalf("items = %d, want %d", got, maxSpriteItems)
+	}
+	c.remember(&c.diffs, -1, image.Rectangle{}, 10)
+	if got := c.items.Load(); got != 1 {
+		t.Errorf("items after reset = %d, want 1", got)
+	}
+	if want := c.baseSize + 10 + spriteItemOverhead; c.size.Load() != want {
+		t.Errorf("size after reset = %d, want %d", c.size.Load(), want)
+	}
+}
+
+func TestForgetFontDropsItsSprites(t *testing.T) {
+	kept := cacheKey{NumberFontName: "forget-test-kept"}
+	gone := cacheKey{NumberFontName: "forget-test-gone"}
+	for _, key := range []cacheKey{kept, gone} {
+		spriteCaches.get(key, func() *spriteCache { return &spriteCache{} })
+	}
+
+	ForgetFont(gone.NumberFontName)
+
+	spriteCaches.mu.Lock()
+	defer spriteCaches.mu.Unlock()
+	if _, ok := spriteCaches.items[gone]; ok {
+		t.Error("sprites of the forgotten font are still cached")
+	}
+	if _, ok := spriteCaches.items[kept]; !ok {
+		t.Error("sprites of another font were dropped")
+	}
+}
+
+func TestForgetImageDropsItsSprites(t *testing.T) {
+	kept := cacheKey{BackgroundImage: "forget-test-kept"}
+	gone := cacheKey{BackgroundImage: "forget-test-gone"}
+	for _, key := range []cacheKey{kept, gone} {
+		spriteCaches.get(key, func() *spriteCache { return &spriteCache{} })
+	}
+
+	ForgetImage(gone.BackgroundImage)
+
+	spriteCaches.mu.Lock()
+	defer spriteCaches.mu.Unlock()
+	if _, ok := spriteCaches.items[gone]; ok {
+		t.Error("sprites over the forgotten image are still cached")
+	}
+	if _, ok := spriteCaches.items[kept]; !ok {
+		t.Error("sprites over another image were dropped")
+	}
+}
@@ -0,0 +1,447 @@
+package gif
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// StyleVersion is the StyleConfig schema version this build writes. Stored
+// styles of an older version are upgraded by MigrateStyle.
+const StyleVersion = 1
+
+// StyleConfig is a timer's design as clients send it and templates store it
+// (Template.StyleConfig). Colors are hex strings like "#ff5733"; an empty
+// color or a zero size means the default.
+type StyleConfig struct {
+	Version int `json:"version"`
+
+	// General
+	Layout     string `json:"layout"`
+	Transition string `json:"transition"`
+
+	// Animation: frames is 10, 30, 60 or 120, frame_delay is in hundredths
+	// of a second and loop is forever or once
+	Frames     int    `json:"frames"`
+	FrameDelay int    `json:"frame_delay"`
+	Loop       string `json:"loop"`
+
+	// Which units to show
+	ShowDays    bool           `json:"show_days"`
+	ShowHours   bool           `json:"show_hours"`
+	ShowMinutes bool           `json:"show_minutes"`
+	ShowSeconds bool           `json:"show_seconds"`
+	MinDigits   map[string]int `json:"min_digits,omitempty"`
+
+	// Numbers
+	NumberFont     string  `json:"number_font"`
+	NumberFontSize float64 `json:"number_font_size"`
+	NumberColor    string  `json:"number_color"`
+
+	// Labels; label_color defaults to number_color
+	ShowLabels    bool              `json:"show_labels"`
+	LabelFont     string            `json:"label_font"`
+	LabelFontSize float64           `json:"label_font_size"`
+	LabelColor    string            `json:"label_color"`
+	Locale        string            `json:"locale"`
+	LabelCase     string            `json:"label_case"`
+	Labels        map[string]string `json:"labels,omitempty"`
+
+	// Separators; separator_color defaults to number_color
+	ShowSeparators bool   `json:"show_separators"`
+	SeparatorColor string `json:"separator_color"`
+
+	// Background
+	BgColor        string `json:"bg_color"`
+	Transparent    bool   `json:"transparent"`
+	MatteColor     string `json:"matte_color"`
+	RoundedCorners bool   `json:"rounded_corners"`
+	CornerRadius   int    `json:"corner_radius"`
+	Dither         bool   `json:"dither"`
+
+	// Gradient and image backgrounds; bg_image is an uploaded image's ID
+	// and bg_fit is cover, contain or tile
+	BgGradient *GradientStyle `json:"bg_gradient,omitempty"`
+	BgImage    string         `json:"bg_image"`
+	BgFit      string         `json:"bg_fit"`
+
+	// Expired state; expire_text_color defaults to number_color
+	ExpireBehavior     string  `json:"expire_behavior"`
+	ExpireText         string  `json:"expire_text"`
+	ExpireTextFont     string  `json:"expire_text_font"`
+	ExpireTextFontSize float64 `json:"expire_text_font_size"`
+	ExpireTextColor    string  `json:"expire_text_color"`
+}
+
+// GradientStyle is a background gradient in a StyleConfig.
+type GradientStyle struct {
+	Type  string         `json:"type"`  // linear or radial
+	Angle float64        `json:"angle"` // degrees, for linear gradients
+	Stops []GradientStep `json:"stops"`
+}
+
+// GradientStep is a stop of a GradientStyle.
+type GradientStep struct {
+	Offset float64 `json:"offset"`
+	Color  string  `json:"color"`
+}
+
+// gradient converts g to a Gradient. Stops with a malformed color are kept
+// without one, so Validate rejects the gradient.
+func (g *GradientStyle) gradient() Gradient {
+	if g == nil {
+		return Gradient{}
+	}
+	grad := Gradient{Type: g.Type, Angle: g.Angle}
+	for _, s := range g.Stops {
+		grad.Stops = append(grad.Stops, GradientStop{Offset: s.Offset, Color: parseColorFallback(s.Color, nil)})
+	}
+	return grad
+}
+
+// DefaultStyle returns the style used for anything a client leaves out.
+func DefaultStyle() StyleConfig {
+	return StyleConfig{
+		Version:        StyleVersion,
+		ShowDays:       true,
+		ShowHours:      true,
+		ShowMinutes:    true,
+		ShowSeconds:    true,
+		NumberFontSize: 60,
+		NumberColor:    "#000000",
+		ShowLabels:     true,
+		LabelFontSize:  14,
+		ShowSeparators: true,
+		BgColor:        "#ffffff",
+	}
+}
+
+// ParseStyle decodes a style sent by a client, filling in defaults for any
+// field it leaves out. It does not validate the style.
+func ParseStyle(data []byte) (StyleConfig, error) {
+	s := DefaultStyle()
+	if err := json.Unmarshal(data, &s); err != nil {
+		return DefaultStyle(), err
+	}
+	return s, nil
+}
+
+// FieldError is a problem with one field of a StyleConfig, named by its
+// JSON key.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists everything wrong with a StyleConfig.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Bounds on sizes, which set how large and costly a render is. Corner radii
+// are also held to half the timer's shorter side when drawn.
+const (
+	maxFontSize     = 300
+	maxCornerRadius = 500
+)
+
+// Validate reports every invalid field of s as ValidationErrors, or nil if
+// s is valid. Whether bg_image names an existing upload is left to the
+// caller.
+func (s StyleConfig) Validate() error {
+	var errs ValidationErrors
+	check := func(ok bool, field, msg string) {
+		if !ok {
+			errs = append(errs, FieldError{Field: field, Message: msg})
+		}
+	}
+	checkColor := func(hex, field string) {
+		if hex != "" {
+			_, err := parseHexColor(hex)
+			check(err == nil, field, "must be a hex color like #ff5733")
+		}
+	}
+	checkFontSize := func(size float64, field string) {
+		check(size >= 0 && size <= maxFontSize, field, fmt.Sprintf("must be between 0 and %d", maxFontSize))
+	}
+
+	check(s.Version >= 0 && s.Version <= StyleVersion, "version", fmt.Sprintf("must be at most %d", StyleVersion))
+	check(ValidLayout(s.Layout), "layout", "unknown layout")
+	check(ValidTransition(s.Transition), "transition", "must be none, slide, flip or fade")
+	check(ValidFrameCount(s.Frames), "frames", "must be 10, 30, 60 or 120")
+	check(ValidFrameDelay(s.FrameDelay), "frame_delay", fmt.Sprintf("must be between %d and %d", minFrameDelay, maxFrameDelay))
+	check(ValidLoop(s.Loop), "loop", "must be forever or once")
+
+	for _, key := range sortedKeys(s.MinDigits) {
+		check(isUnitKey(key), "min_digits."+key, "unknown unit")
+		n := s.MinDigits[key]
+		check(n >= 0 && n <= maxMinDigits, "min_digits."+key, fmt.Sprintf("must be between 0 and %d", maxMinDigits))
+	}
+
+	checkFontSize(s.NumberFontSize, "number_font_size")
+	checkColor(s.NumberColor, "number_color")
+
+	checkFontSize(s.LabelFontSize, "label_font_size")
+	checkColor(s.LabelColor, "label_color")
+	check(ValidLocale(s.Locale), "locale", "unsupported locale")
+	check(ValidLabelCase(s.LabelCase), "label_case", "unknown label case")
+	for _, key := range sortedKeys(s.Labels) {
+		check(isUnitKey(key), "labels."+key, "unknown unit")
+	}
+
+	checkColor(s.SeparatorColor, "separator_color")
+
+	checkColor(s.BgColor, "bg_color")
+	checkColor(s.MatteColor, "matte_color")
+	check(s.CornerRadius >= 0 && s.CornerRadius <= maxCornerRadius, "corner_radius", fmt.Sprintf("must be between 0 and %d", maxCornerRadius))
+	if err := s.BgGradient.gradient().Validate(); err != nil {
+		check(false, "bg_gradient", err.Error())
+	}
+	check(ValidFit(s.BgFit), "bg_fit", "must be cover, contain or tile")
+
+	check(ValidExpireBehavior(s.ExpireBehavior), "expire_behavior", "must be show_zeros, hide or custom_text")
+	checkFontSize(s.ExpireTextFontSize, "expire_text_font_size")
+	checkColor(s.ExpireTextColor, "expire_text_color")
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Config converts s to a generator Config; every handler that renders a
+// style goes through here. EndTime, Now and Expired are left for the
+// caller. Invalid fields fall back to their defaults, so a style that was
+// not validated still renders.
+func (s StyleConfig) Config() Config {
+	textColor := parseColorFallback(s.NumberColor, color.RGBA{A: 255})
+
+	numberFontSize := s.NumberFontSize
+	if numberFontSize <= 0 || numberFontSize > maxFontSize {
+		numberFontSize = 60
+	}
+	labelFontSize := s.LabelFontSize
+	if labelFontSize <= 0 || labelFontSize > maxFontSize {
+		labelFontSize = 14
+	}
+
+	cfg := Config{
+		Background: parseColorFallback(s.BgColor, color.RGBA{R: 255, G: 255, B: 255, A: 255}),
+		TextColor:  textColor,
+
+		NumberFontName: s.NumberFont,
+		NumberFontSize: numberFontSize,
+
+		ShowLabels:    s.ShowLabels,
+		LabelFontName: s.LabelFont,
+		LabelFontSize: labelFontSize,
+		LabelColor:    parseColorFallback(s.LabelColor, textColor),
+		Labels:        LabelsFromMap(s.Labels),
+
+		ShowSeparators: s.ShowSeparators,
+		SeparatorColor: parseColorFallback(s.SeparatorColor, textColor),
+
+		ShowDays:    s.ShowDays,
+		ShowHours:   s.ShowHours,
+		ShowMinutes: s.ShowMinutes,
+		ShowSeconds: s.ShowSeconds,
+		MinDigits:   MinDigitsFromMap(s.MinDigits),
+
+		Transparent:    s.Transparent,
+		MatteColor:     parseColorFallback(s.MatteColor, nil),
+		RoundedCorners: s.RoundedCorners,
+		CornerRadius:   min(max(s.CornerRadius, 0), maxCornerRadius),
+		Dither:         s.Dither,
+
+		BackgroundImage: s.BgImage,
+
+		ExpireText:      s.ExpireText,
+		ExpireTextFont:  s.ExpireTextFont,
+		ExpireTextSize:  min(max(s.ExpireTextFontSize, 0), maxFontSize),
+		ExpireTextColor: parseColorFallback(s.ExpireTextColor, textColor),
+	}
+
+	if ValidLayout(s.Layout) {
+		cfg.Layout = s.Layout
+	}
+	if ValidTransition(s.Transition) {
+		cfg.Transition = s.Transition
+	}
+	if ValidFrameCount(s.Frames) {
+		cfg.Frames = s.Frames
+	}
+	if ValidFrameDelay(s.FrameDelay) {
+		cfg.FrameDelay = s.FrameDelay
+	}
+	if ValidLoop(s.Loop) {
+		cfg.Loop = s.Loop
+	}
+	if ValidLocale(s.Locale) {
+		cfg.Locale = s.Locale
+	}
+	if ValidLabelCase(s.LabelCase) {
+		cfg.LabelCase = s.LabelCase
+	}
+	if g := s.BgGradient.gradient(); g.Validate() == nil {
+		cfg.Gradient = g
+	}
+	if ValidFit(s.BgFit) {
+		cfg.BackgroundFit = s.BgFit
+	}
+	if ValidExpireBehavior(s.ExpireBehavior) {
+		cfg.ExpireBehavior = s.ExpireBehavior
+	}
+
+	return cfg
+}
+
+// styleMigrations[v] upgrades a stored style from version v to v+1. They
+// work on the decoded JSON, so they can read fields the current schema no
+// longer has.
+var styleMigrations = []func(style map[string]interface{}){
+	migrateStyleV0,
+}
+
+// migrateStyleV0 upgrades the unversioned styles saved before StyleConfig.
+// Those drew labels and separators black unless given their own color,
+// where StyleConfig defaults them to the number color.
+func migrateStyleV0(style map[string]interface{}) {
+	for _, key := range []string{"label_color", "separator_color"} {
+		if v, _ := style[key].(string); v == "" {
+			style[key] = "#000000"
+		}
+	}
+}
+
+// MigrateStyle decodes a stored Template.StyleConfig and upgrades it to
+// StyleVersion; an empty string is an unversioned style with every field
+// left out. As renders always have, a field of the wrong type or with an
+// invalid value falls back to its default rather than failing the whole
+// style. Only JSON that does not decode, or a version newer than this
+// build knows, is an error.
+func MigrateStyle(stored string) (StyleConfig, error) {
+	style := map[string]interface{}{}
+	if strings.TrimSpace(stored) != "" {
+		if err := json.Unmarshal([]byte(stored), &style); err != nil {
+			return DefaultStyle(), err
+		}
+	}
+
+	// A missing or negative version is an unversioned style
+	version := 0
+	if v, ok := style["version"].(float64); ok && v > 0 {
+		version = int(v)
+	}
+	if version > StyleVersion {
+		return DefaultStyle(), fmt.Errorf("style version %d is newer than %d", version, StyleVersion)
+	}
+	for ; version < StyleVersion; version++ {
+		styleMigrations[version](style)
+	}
+	style["version"] = StyleVersion
+
+	s := DefaultStyle()
+	setStyleFields(&s, style)
+
+	// Reset whatever is invalid to its default
+	if errs, ok := s.Validate().(ValidationErrors); ok {
+		var defaults map[string]interface{}
+		data, _ := json.Marshal(DefaultStyle())
+		json.Unmarshal(data, &defaults)
+
+		invalid := map[string]interface{}{}
+		for _, fe := range errs {
+			key, _, _ := strings.Cut(fe.Field, ".")
+			invalid[key] = defaults[key]
+		}
+		setStyleFields(&s, invalid)
+	}
+	return s, nil
+}
+
+// setStyleFields decodes each of fields into s on its own, so a value of the
+// wrong type leaves only that field unchanged.
+func setStyleFields(s *StyleConfig, fields map[string]interface{}) {
+	for key, v := range fields {
+		data, err := json.Marshal(map[string]interface{}{key: v})
+		if err != nil {
+			continue
+		}
+		json.Unmarshal(data, s)
+	}
+}
+
+// unitKeys name the units in style configs and requests, in Config order.
+var unitKeys = [4]string{"days", "hours", "minutes", "seconds"}
+
+func isUnitKey(key string) bool {
+	for _, k := range unitKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LabelsFromMap converts custom labels keyed by unit name ("days", "hours",
+// "minutes", "seconds") to Config.Labels.
+func LabelsFromMap(m map[string]string) [4]string {
+	var labels [4]string
+	for i, key := range unitKeys {
+		labels[i] = m[key]
+	}
+	return labels
+}
+
+// MinDigitsFromMap converts minimum digit counts keyed by unit name to
+// Config.MinDigits.
+func MinDigitsFromMap(m map[string]int) [4]int {
+	var digits [4]int
+	for i, key := range unitKeys {
+		digits[i] = m[key]
+	}
+	return digits
+}
+
+func parseColorFallback(hex string, fallback color.Color) color.Color {
+	if hex == "" {
+		return fallback
+	}
+	c, err := parseHexColor(hex)
+	if err != nil {
+		return fallback
+	}
+	return c
+}
+
+func parseHexColor(hex string) (color.Color, error) {
+	var r, g, b uint8
+	if len(hex) > 0 && hex[0] == '#' {
+		hex = hex[1:]
+	}
+	if len(hex) != 6 {
+		return nil, fmt.Errorf("invalid hex color: %s", hex)
+	}
+	_, err := fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b)
+	if err != nil {
+		return nil, err
+	}
+	return color.RGBA{R: r, G: g, B: b, A: 255}, nil
+}
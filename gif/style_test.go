@@ -0,0 +1,82 @@
+package gif
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMigrateStyleVersion(t *testing.T) {
+	tests := []struct {
+		stored     string
+		wantErr    bool
+		labelColor string // after migration
+	}{
+		{`{"version":-1}`, false, "#000000"},
+		{`{"version":0}`, false, "#000000"},
+		{`{}`, false, "#000000"},
+		{fmt.Sprintf(`{"version":%d}`, StyleVersion), false, ""},
+		{fmt.Sprintf(`{"version":%d}`, StyleVersion+1), true, ""},
+	}
+	for _, tt := range tests {
+		style, err := MigrateStyle(tt.stored)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("MigrateStyle(%s) error = %v, want error %v", tt.stored, err, tt.wantErr)
+			continue
+		}
+		if style.Version != StyleVersion {
+			t.Errorf("MigrateStyle(%s) version = %d, want %d", tt.stored, style.Version, StyleVersion)
+		}
+		if !tt.wantErr && style.LabelColor != tt.labelColor {
+			t.Errorf("MigrateStyle(%s) label_color = %q, want %q", tt.stored, style.LabelColor, tt.labelColor)
+		}
+	}
+}
+
+func TestValidateSizeLimits(t *testing.T) {
+	tests := []struct {
+		field string
+		set   func(s *StyleConfig)
+		valid bool
+	}{
+		{"number_font_size", func(s *StyleConfig) { s.NumberFontSize = 300 }, true},
+		{"number_font_size", func(s *StyleConfig) { s.NumberFontSize = 300.5 }, false},
+		{"number_font_size", func(s *StyleConfig) { s.NumberFontSize = -1 }, false},
+		{"label_font_size", func(s *StyleConfig) { s.LabelFontSize = 300 }, true},
+		{"label_font_size", func(s *StyleConfig) { s.LabelFontSize = 5000 }, false},
+		{"expire_text_font_size", func(s *StyleConfig) { s.ExpireTextFontSize = 0 }, true},
+		{"expire_text_font_size", func(s *StyleConfig) { s.ExpireTextFontSize = 301 }, false},
+		{"corner_radius", func(s *StyleConfig) { s.CornerRadius = maxCornerRadius }, true},
+		{"corner_radius", func(s *StyleConfig) { s.CornerRadius = maxCornerRadius + 1 }, false},
+		{"corner_radius", func(s *StyleConfig) { s.CornerRadius = -1 }, false},
+	}
+	for _, tt := range tests {
+		s := DefaultStyle()
+		tt.set(&s)
+		err := s.Validate()
+		var fields []string
+		if errs, ok := err.(ValidationErrors); ok {
+			for _, fe := range errs {
+				fields = append(fields, fe.Field)
+			}
+		}
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.field, err)
+		}
+		if !tt.valid && (len(fields) != 1 || fields[0] != tt.field) {
+			t.Errorf("%s: got errors %v, want one for %s", tt.field, fields, tt.field)
+		}
+	}
+}
+
+func TestConfigClampsSizes(t *testing.T) {
+	s := DefaultStyle()
+	s.NumberFontSize, s.LabelFontSize, s.ExpireTextFontSize = 5000, 5000, 5000
+	s.CornerRadius = 1 << 20
+	cfg := s.Config()
+	if cfg.NumberFontSize > maxFontSize || cfg.LabelFontSize > maxFontSize || cfg.ExpireTextSize > maxFontSize {
+		t.Errorf("font sizes %v, %v, %v exceed %d", cfg.NumberFontSize, cfg.LabelFontSize, cfg.ExpireTextSize, maxFontSize)
+	}
+	if cfg.CornerRadius > maxCornerRadius {
+		t.Errorf("corner radius %d exceeds %d", cfg.CornerRadius, maxCornerRadius)
+	}
+}
@@ -0,0 +1,215 @@
+package gif
+
+import (
+	"image"
+	"math"
+)
+
+// Transition effects played when a column's value changes.
+const (
+	TransitionNone  = "none"  // hard cut, the default
+	TransitionSlide = "slide" // the new digits roll in from above
+	TransitionFlip  = "flip"  // split-flap: the top half folds down
+	TransitionFade  = "fade"  // the old digits cross-fade into the new
+)
+
+// Transitions are played as transitionSteps frames of up to
+// maxTransitionDelay hundredths of a second each, taken out of the frame
+// they lead into.
+const (
+	transitionSteps    = 4
+	maxTransitionDelay = 6
+)
+
+// ValidTransition reports whether name is a supported transition. The empty
+// string is valid and means none.
+func ValidTransition(name string) bool {
+	switch name {
+	case "", TransitionNone, TransitionSlide, TransitionFlip, TransitionFade:
+		return true
+	}
+	return false
+}
+
+// hasTransition reports whether value changes are animated.
+func (c Config) hasTransition() bool {
+	return c.Transition != "" && c.Transition != TransitionNone
+}
+
+// tweenDelay returns the delay of each transition frame, or 0 if there is no
+// transition or frames are too short to fit one.
+func (c Config) tweenDelay() int {
+	if !c.hasTransition() {
+		return 0
+	}
+	d := min(maxTransitionDelay, c.frameDelay()/(transitionSteps+2))
+	if d < 2 {
+		// Browsers slow delays under 2 down to 10
+		return 0
+	}
+	return d
+}
+
+// transitionRect widens the changed part of a sprite to the region a
+// transition draws in. Slides and flips move whole digits, so they cover
+// the changed digits' full height.
+func (c Config) transitionRect(changed image.Rectangle, spriteH int) image.Rectangle {
+	if changed.Empty() {
+		return changed
+	}
+	switch c.Transition {
+	case TransitionSlide, TransitionFlip:
+		return image.Rect(changed.Min.X, 0, changed.Max.X, spriteH)
+	}
+	return changed
+}
+
+type tweenKey struct {
+	from, to   *image.Paletted
+	transition string
+	step       int
+}
+
+// tweenSprite returns the sprite shown at step (0 … transitionSteps-1) of
+// the transition from one number sprite to the next. Only region, in sprite
+// coordinates, differs from the from sprite.
+func (c *spriteCache) tweenSprite(transition string, from, to *image.Paletted, region image.Rectangle, step int) *image.Paletted {
+	key := tweenKey{from: from, to: to, transition: transition, step: step}
+	if sprite, ok := c.tweens.Load(key); ok {
+		return sprite.(*image.Paletted)
+	}
+
+	dst := image.NewPaletted(from.Rect, from.Palette)
+	copy(dst.Pix, from.Pix)
+	t := float64(step+1) / float64(transitionSteps+1)
+	if c.backdrop != nil {
+		c.tweenOverBackdrop(dst, transition, from, to, region, t)
+	} else {
+		switch transition {
+		case TransitionSlide:
+			slideRegion(dst.Pix, from.Pix, to.Pix, dst.Stride, region, t)
+		case TransitionFlip:
+			flipRegion(dst.Pix, from.Pix, to.Pix, dst.Stride, region, t)
+		case TransitionFade:
+			fadeRegion(dst, from, to, region, t, c.quant)
+		}
+	}
+
+	return c.remember(&c.tweens, key, dst, len(dst.Pix)).(*image.Paletted)
+}
+
+// The slide and flip effects move rows of one-byte-per-pixel images: the
+// palette indexes of flat sprites, or the glyph coverage of sprites over a
+// backdrop. All three images share stride and start at the origin.
+
+// copyRow copies row sy of src to row dy of dst, between x0 and x1.
+func copyRow(dst, src []uint8, stride, dy, sy, x0, x1 int) {
+	copy(dst[dy*stride+x0:dy*stride+x1], src[sy*stride+x0:sy*stride+x1])
+}
+
+// slideRegion moves the old digits down and out of region while the new
+// ones follow them in from the top, like a counter wheel turning back.
+func slideRegion(dst, from, to []uint8, stride int, r image.Rectangle, t float64) {
+	h := r.Dy()
+	off := int(math.Round(t * float64(h)))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		if y-r.Min.Y < off {
+			copyRow(dst, to, stride, y, y+h-off, r.Min.X, r.Max.X)
+		} else {
+			copyRow(dst, from, stride, y, y-off, r.Min.X, r.Max.X)
+		}
+	}
+}
+
+// flipRegion draws a split-flap card turning over: in the first half the
+// old top half folds down onto the middle, uncovering the new top half;
+// in the second the new bottom half unfolds over the old one.
+func flipRegion(dst, from, to []uint8, stride int, r image.Rectangle, t float64) {
+	mid := r.Min.Y + r.Dy()/2
+	for y := r.Min.Y; y < mid; y++ {
+		copyRow(dst, to, stride, y, y, r.Min.X, r.Max.X)
+	}
+
+	if t < 0.5 {
+		// The old top half, squashed toward the middle
+		half := mid - r.Min.Y
+		fold := int(math.Round(float64(half) * (1 - 2*t)))
+		for y := mid - fold; y < mid; y++ {
+			sy := mid - (mid-y)*half/fold
+			copyRow(dst, from, stride, y, sy, r.Min.X, r.Max.X)
+		}
+		return
+	}
+
+	// The new bottom half, growing down from the middle
+	half := r.Max.Y - mid
+	fold := int(math.Round(float64(half) * (2*t - 1)))
+	for y := mid; y < mid+fold; y++ {
+		sy := mid + (y-mid)*half/fold
+		copyRow(dst, to, stride, y, sy, r.Min.X, r.Max.X)
+	}
+}
+
+// tweenOverBackdrop draws a transition step into region of dst for sprites
+// composed over a backdrop. The effect is applied to the glyph coverage
+// alone, so the backdrop stays in place while the digits move over it.
+func (c *spriteCache) tweenOverBackdrop(dst *image.Paletted, transition string, from, to *image.Paletted, region image.Rectangle, t float64) {
+	fromKey, ok1 := c.spriteKeys.Load(from)
+	toKey, ok2 := c.spriteKeys.Load(to)
+	if !ok1 || !ok2 {
+		return
+	}
+	fk, tk := fromKey.(numberKey), toKey.(numberKey)
+	fromMask, toMask := c.numberMask(fk), c.numberMask(tk)
+
+	mask := image.NewAlpha(fromMask.Rect)
+	copy(mask.Pix, fromMask.Pix)
+	switch transition {
+	case TransitionSlide:
+		slideRegion(mask.Pix, fromMask.Pix, toMask.Pix, mask.Stride, region, t)
+	case TransitionFlip:
+		flipRegion(mask.Pix, fromMask.Pix, toMask.Pix, mask.Stride, region, t)
+	case TransitionFade:
+		for i := range mask.Pix {
+			mask.Pix[i] = uint8(math.Round(float64(fromMask.Pix[i])*(1-t) + float64(toMask.Pix[i])*t))
+		}
+	}
+
+	quantized := c.inkOverBackdrop(mask, region, fk.origin)
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		copy(dst.Pix[dst.PixOffset(region.Min.X, y):][:region.Dx()], quantized.Pix[quantized.PixOffset(region.Min.X, y):])
+	}
+}
+
+// fadeRegion blends the old and new digits, t of the way to the new, and
+// maps the result onto the sprite palette. Transparent pixels cannot be
+// blended, so they switch over halfway.
+func fadeRegion(dst, from, to *image.Paletted, r image.Rectangle, t float64, quant *quantizer) {
+	blended := make(map[[2]uint8]uint8)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			a, b := from.Pix[from.PixOffset(x, y)], to.Pix[to.PixOffset(x, y)]
+			if a == b {
+				continue
+			}
+			idx, ok := blended[[2]uint8{a, b}]
+			if !ok {
+				idx = blendIndex(quant, a, b, t)
+				blended[[2]uint8{a, b}] = idx
+			}
+			dst.Pix[dst.PixOffset(x, y)] = idx
+		}
+	}
+}
+
+// blendIndex returns the opaque palette entry nearest to a mix of entries a
+// and b, t of the way to b.
+func blendIndex(quant *quantizer, a, b uint8, t float64) uint8 {
+	if int(a) == quant.transparent || int(b) == quant.transparent {
+		if t < 0.5 {
+			return a
+		}
+		return b
+	}
+	return quant.index(mixRGBA(quant.colors[a], quant.colors[b], t))
+}
@@ -0,0 +1,666 @@
+package gif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+	"slices"
+	"sort"
+)
+
+// encodeWebP writes the animation as a lossless animated WebP.
+//
+// WebP frames have to start at even coordinates and blend differently from
+// GIF frames, so rather than mapping frames across one by one, the canvas
+// is played back and each frame is stored as the change it makes to what
+// is shown, replacing (not blending over) an even-aligned rectangle.
+func (a *Animation) encodeWebP(w io.Writer) error {
+	if len(a.Frames) == 0 {
+		return errors.New("webp: no frames")
+	}
+	if a.Width > 1<<14 || a.Height > 1<<14 {
+		return errors.New("webp: image too large")
+	}
+
+	canvas := image.Rect(0, 0, a.Width, a.Height)
+	cur := make([]uint32, a.Width*a.Height)
+	var shown []uint32
+	var frames []webpFrame
+	alpha := false
+	for i, f := range a.Frames {
+		argb := paletteARGB(f.Image.Palette)
+		r := f.Image.Rect.Intersect(canvas)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			row := f.Image.Pix[f.Image.PixOffset(r.Min.X, y):]
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if c := argb[row[x-r.Min.X]]; c>>24 != 0 {
+					cur[y*a.Width+x] = c
+				}
+			}
+		}
+
+		rect := canvas
+		if i > 0 {
+			rect = changedARGB(shown, cur, a.Width, a.Height)
+			rect.Min.X &^= 1
+			rect.Min.Y &^= 1
+		}
+		if rect.Empty() {
+			frames[len(frames)-1].duration += f.Delay * 10
+		} else {
+			sub := make([]uint32, 0, rect.Dx()*rect.Dy())
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				sub = append(sub, cur[y*a.Width+rect.Min.X:y*a.Width+rect.Max.X]...)
+			}
+			for _, c := range sub {
+				alpha = alpha || c>>24 != 0xff
+			}
+			frames = append(frames, webpFrame{rect: rect, pix: sub, duration: f.Delay * 10})
+		}
+
+		shown = append(shown[:0], cur...)
+		if f.Clear {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				clear(cur[y*a.Width+r.Min.X : y*a.Width+r.Max.X])
+			}
+		}
+	}
+
+	parallelFor(len(frames), func(i int) {
+		f := &frames[i]
+		f.data = encodeVP8L(f.pix, f.rect.Dx(), f.rect.Dy())
+	})
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x02 // animation
+	if alpha {
+		vp8x[0] |= 0x10
+	}
+	putUint24(vp8x[4:], a.Width-1)
+	putUint24(vp8x[7:], a.Height-1)
+	writeRIFFChunk(&body, "VP8X", vp8x)
+
+	anim := make([]byte, 6)
+	binary.LittleEndian.PutUint16(anim[4:], uint16(a.Plays))
+	writeRIFFChunk(&body, "ANIM", anim)
+
+	for _, f := range frames {
+		var frame bytes.Buffer
+		header := make([]byte, 16)
+		putUint24(header[0:], f.rect.Min.X/2)
+		putUint24(header[3:], f.rect.Min.Y/2)
+		putUint24(header[6:], f.rect.Dx()-1)
+		putUint24(header[9:], f.rect.Dy()-1)
+		putUint24(header[12:], min(f.duration, 1<<24-1))
+		header[15] = 0x02 // replace the rectangle rather than blend over it
+		frame.Write(header)
+		writeRIFFChunk(&frame, "VP8L", f.data)
+		writeRIFFChunk(&body, "ANMF", frame.Bytes())
+	}
+
+	var out bytes.Buffer
+	writeRIFFChunk(&out, "RIFF", body.Bytes())
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+type webpFrame struct {
+	rect     image.Rectangle
+	pix      []uint32 // ARGB
+	duration int      // milliseconds
+	data     []byte
+}
+
+// paletteARGB converts a palette to non-premultiplied ARGB. Transparent
+// entries are all zero.
+func paletteARGB(p color.Palette) []uint32 {
+	argb := make([]uint32, 256)
+	for i, c := range p {
+		r, g, b, a := c.RGBA()
+		if a == 0 {
+			continue
+		}
+		r, g, b = r*0xffff/a, g*0xffff/a, b*0xffff/a
+		argb[i] = a>>8<<24 | r>>8<<16 | g>>8<<8 | b>>8
+	}
+	return argb
+}
+
+// changedARGB returns the bounds of the pixels that differ between a and b.
+func changedARGB(a, b []uint32, width, height int) image.Rectangle {
+	r := image.Rectangle{Min: image.Pt(width, height)}
+	for y := 0; y < height; y++ {
+		row := y * width
+		for x := 0; x < width; x++ {
+			if a[row+x] != b[row+x] {
+				r.Min.X = min(r.Min.X, x)
+				r.Max.X = max(r.Max.X, x+1)
+				r.Min.Y = min(r.Min.Y, y)
+				r.Max.Y = y + 1
+			}
+		}
+	}
+	if r.Max.Y == 0 {
+		return image.Rectangle{}
+	}
+	return r
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func writeRIFFChunk(buf *bytes.Buffer, fourCC string, data []byte) {
+	buf.WriteString(fourCC)
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(data)))
+	buf.Write(n[:])
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// VP8L encoding. Frames are stored losslessly with a color-indexing
+// transform when they have at most 256 colors (which they always do, coming
+// from a palette), LZ77 backward references and one set of prefix codes.
+
+const (
+	vp8lMaxLength   = 4096
+	vp8lMaxDistance = 1<<20 - 120
+	vp8lHashBits    = 16
+	vp8lNumLength   = 24 // length prefix codes
+	vp8lNumDistance = 40 // distance prefix codes
+)
+
+// vp8lCodeLengthOrder is the order code length code lengths are stored in.
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// encodeVP8L encodes width×height ARGB pixels as a VP8L bitstream.
+func encodeVP8L(pix []uint32, width, height int) []byte {
+	bw := &bitWriter{}
+	bw.writeBits(0x2f, 8)
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	alpha := uint32(0)
+	for _, c := range pix {
+		if c>>24 != 0xff {
+			alpha = 1
+			break
+		}
+	}
+	bw.writeBits(alpha, 1)
+	bw.writeBits(0, 3) // version
+
+	if palette, ok := argbPalette(pix); ok {
+		bw.writeBits(1, 1) // transform present
+		bw.writeBits(3, 2) // color indexing
+		bw.writeBits(uint32(len(palette)-1), 8)
+
+		// The palette is stored as an image of its own, each entry as the
+		// difference from the one before.
+		deltas := make([]uint32, len(palette))
+		for i, c := range palette {
+			if i == 0 {
+				deltas[i] = c
+				continue
+			}
+			deltas[i] = subPixels(c, palette[i-1])
+		}
+		writeVP8LImage(bw, deltas, len(deltas), false)
+
+		pix, width = bundlePixels(pix, width, height, palette)
+	}
+	bw.writeBits(0, 1) // no more transforms
+
+	writeVP8LImage(bw, pix, width, true)
+	return bw.bytes()
+}
+
+// argbPalette returns the sorted distinct colors of pix, if there are at
+// most 256.
+func argbPalette(pix []uint32) ([]uint32, bool) {
+	seen := make(map[uint32]struct{})
+	for _, c := range pix {
+		if _, ok := seen[c]; !ok {
+			if len(seen) == 256 {
+				return nil, false
+			}
+			seen[c] = struct{}{}
+		}
+	}
+	palette := make([]uint32, 0, len(seen))
+	for c := range seen {
+		palette = append(palette, c)
+	}
+	slices.Sort(palette)
+	return palette, true
+}
+
+// bundlePixels replaces each pixel with its palette index in the green
+// channel, packing several indices into one pixel when the palette is small
+// enough, and returns the new pixels and width.
+func bundlePixels(pix []uint32, width, height int, palette []uint32) ([]uint32, int) {
+	index := make(map[uint32]uint32, len(palette))
+	for i, c := range palette {
+		index[c] = uint32(i)
+	}
+	var widthBits uint
+	switch n := len(palette); {
+	case n <= 2:
+		widthBits = 3
+	case n <= 4:
+		widthBits = 2
+	case n <= 16:
+		widthBits = 1
+	}
+	perPixel := 1 << widthBits
+	bitsPerIndex := 8 >> widthBits
+	packedWidth := (width + perPixel - 1) / perPixel
+
+	packed := make([]uint32, packedWidth*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := index[pix[y*width+x]]
+			shift := uint(x%perPixel*bitsPerIndex + 8)
+			packed[y*packedWidth+x/perPixel] |= idx << shift
+		}
+	}
+	return packed, packedWidth
+}
+
+// subPixels subtracts b from a channel by channel, modulo 256.
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// vp8lSymbol is one LZ77 token: a literal pixel, or a copy of length pixels
+// from dist back.
+type vp8lSymbol struct {
+	argb   uint32
+	length int // 0 for a literal
+	dist   int // distance code, already mapped
+}
+
+// writeVP8LImage writes pix, width pixels wide, as an entropy-coded image.
+// The main image also carries the (unused) meta prefix code flag.
+func writeVP8LImage(bw *bitWriter, pix []uint32, width int, main bool) {
+	bw.writeBits(0, 1) // no color cache
+	if main {
+		bw.writeBits(0, 1) // a single set of prefix codes
+	}
+
+	symbols := vp8lBackwardRefs(pix, width)
+
+	var green [256 + vp8lNumLength]int
+	var red, blue, alpha [256]int
+	var dist [vp8lNumDistance]int
+	for _, s := range symbols {
+		if s.length == 0 {
+			alpha[s.argb>>24]++
+			red[s.argb>>16&0xff]++
+			green[s.argb>>8&0xff]++
+			blue[s.argb&0xff]++
+			continue
+		}
+		code, _, _ := vp8lPrefix(s.length)
+		green[256+code]++
+		code, _, _ = vp8lPrefix(s.dist)
+		dist[code]++
+	}
+
+	codes := [5]prefixCode{
+		writePrefixCode(bw, green[:]),
+		writePrefixCode(bw, red[:]),
+		writePrefixCode(bw, blue[:]),
+		writePrefixCode(bw, alpha[:]),
+		writePrefixCode(bw, dist[:]),
+	}
+	for _, s := range symbols {
+		if s.length == 0 {
+			codes[0].write(bw, int(s.argb>>8&0xff))
+			codes[1].write(bw, int(s.argb>>16&0xff))
+			codes[2].write(bw, int(s.argb&0xff))
+			codes[3].write(bw, int(s.argb>>24))
+			continue
+		}
+		code, extra, n := vp8lPrefix(s.length)
+		codes[0].write(bw, 256+code)
+		bw.writeBits(extra, n)
+		code, extra, n = vp8lPrefix(s.dist)
+		codes[4].write(bw, code)
+		bw.writeBits(extra, n)
+	}
+}
+
+// vp8lBackwardRefs greedily finds LZ77 matches in pix, trying the pixel to
+// the left, the one above and the last place the next three pixels were
+// seen.
+func vp8lBackwardRefs(pix []uint32, width int) []vp8lSymbol {
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	hash := func(i int) uint32 {
+		h := pix[i]*0x1e35a7bd ^ pix[i+1]*0x9e3779b1 ^ pix[i+2]*0x85ebca6b
+		return h >> (32 - vp8lHashBits)
+	}
+	matchLen := func(i, j int) int {
+		n := 0
+		for i+n < len(pix) && n < vp8lMaxLength && pix[i+n] == pix[j+n] {
+			n++
+		}
+		return n
+	}
+
+	var symbols []vp8lSymbol
+	for i := 0; i < len(pix); {
+		bestLen, bestDist := 0, 0
+		for _, d := range []int{1, width} {
+			if d <= i {
+				if n := matchLen(i, i-d); n > bestLen {
+					bestLen, bestDist = n, d
+				}
+			}
+		}
+		if i+2 < len(pix) {
+			h := hash(i)
+			if j := int(head[h]); j >= 0 && i-j <= vp8lMaxDistance {
+				if n := matchLen(i, j); n > bestLen {
+					bestLen, bestDist = n, i-j
+				}
+			}
+			head[h] = int32(i)
+		}
+
+		if bestLen < 3 {
+			symbols = append(symbols, vp8lSymbol{argb: pix[i]})
+			i++
+			continue
+		}
+		symbols = append(symbols, vp8lSymbol{length: bestLen, dist: vp8lDistanceCode(bestDist, width)})
+		for k := i + 1; k < i+bestLen && k+2 < len(pix); k++ {
+			head[hash(k)] = int32(k)
+		}
+		i += bestLen
+	}
+	return symbols
+}
+
+// vp8lDistanceCode maps a distance to its code: the pixel above and the one
+// to the left have short codes, the rest are offset past the 120 codes for
+// nearby pixels.
+func vp8lDistanceCode(dist, width int) int {
+	switch dist {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return dist + 120
+}
+
+// vp8lPrefix splits a length or distance code v (at least 1) into its
+// prefix code and extra bits.
+func vp8lPrefix(v int) (code int, extra uint32, n uint) {
+	if v <= 4 {
+		return v - 1, 0, 0
+	}
+	d := v - 1
+	hb := bits.Len(uint(d)) - 1
+	second := d >> (hb - 1) & 1
+	n = uint(hb - 1)
+	return 2*hb + second, uint32(d) & (1<<n - 1), n
+}
+
+// prefixCode is a canonical prefix code, with each code bit-reversed ready
+// to be written.
+type prefixCode struct {
+	codes   []uint32
+	lengths []uint8
+}
+
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	bw.writeBits(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writePrefixCode builds a prefix code for the symbol counts and writes its
+// description.
+func writePrefixCode(bw *bitWriter, counts []int) prefixCode {
+	var used []int
+	for s, n := range counts {
+		if n > 0 {
+			used = append(used, s)
+		}
+	}
+
+	lengths := make([]uint8, len(counts))
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		// Simple code: one or two symbols, listed in order so the first
+		// gets code 0 as it would canonically.
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		bw.writeBits(1, 1)
+		bw.writeBits(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.writeBits(0, 1)
+			bw.writeBits(uint32(used[0]), 1)
+		} else {
+			bw.writeBits(1, 1)
+			bw.writeBits(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.writeBits(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return canonicalCode(lengths)
+	}
+
+	lengths = huffmanLengths(counts, 15)
+	bw.writeBits(0, 1)
+
+	// The code lengths are themselves run-length encoded and prefix coded.
+	type token struct{ sym, extra, n int }
+	var tokens []token
+	prev := 8
+	for i := 0; i < len(lengths); {
+		l := int(lengths[i])
+		run := 1
+		for i+run < len(lengths) && int(lengths[i+run]) == l {
+			run++
+		}
+		i += run
+		if l == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					n := min(run, 138)
+					tokens = append(tokens, token{18, n - 11, 7})
+					run -= n
+				} else {
+					n := min(run, 10)
+					tokens = append(tokens, token{17, n - 3, 3})
+					run -= n
+				}
+			}
+			for ; run > 0; run-- {
+				tokens = append(tokens, token{0, 0, 0})
+			}
+			continue
+		}
+		if l != prev {
+			tokens = append(tokens, token{l, 0, 0})
+			prev = l
+			run--
+		}
+		for run >= 3 {
+			n := min(run, 6)
+			tokens = append(tokens, token{16, n - 3, 2})
+			run -= n
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, token{l, 0, 0})
+		}
+	}
+
+	var lengthCounts [19]int
+	for _, t := range tokens {
+		lengthCounts[t.sym]++
+	}
+	lengthLengths := huffmanLengths(lengthCounts[:], 7)
+	numCodes := 19
+	for numCodes > 4 && lengthLengths[vp8lCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+	bw.writeBits(uint32(numCodes-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:numCodes] {
+		bw.writeBits(uint32(lengthLengths[s]), 3)
+	}
+	bw.writeBits(0, 1) // code lengths for every symbol follow
+
+	lengthCode := canonicalCode(lengthLengths)
+	for _, t := range tokens {
+		lengthCode.write(bw, t.sym)
+		bw.writeBits(uint32(t.extra), uint(t.n))
+	}
+	return canonicalCode(lengths)
+}
+
+// huffmanLengths returns Huffman code lengths for counts, no longer than
+// limit. Counts are halved until the code fits.
+func huffmanLengths(counts []int, limit int) []uint8 {
+	counts = slices.Clone(counts)
+	for {
+		lengths, longest := huffmanTree(counts)
+		if longest <= limit {
+			return lengths
+		}
+		for i, n := range counts {
+			if n > 0 {
+				counts[i] = (n + 1) / 2
+			}
+		}
+	}
+}
+
+// huffmanTree returns unlimited Huffman code lengths for counts, and the
+// longest of them. A lone symbol still gets a length of 1.
+func huffmanTree(counts []int) ([]uint8, int) {
+	type node struct {
+		count       int
+		left, right int // children, or -1 for a leaf
+		symbol      int
+	}
+	var nodes []node
+	for s, n := range counts {
+		if n > 0 {
+			nodes = append(nodes, node{count: n, left: -1, right: -1, symbol: s})
+		}
+	}
+	lengths := make([]uint8, len(counts))
+	if len(nodes) == 1 {
+		lengths[nodes[0].symbol] = 1
+		return lengths, 1
+	}
+
+	// Two queues: the sorted leaves and the internal nodes, which are made
+	// in increasing count order.
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count < nodes[j].count })
+	leaves := len(nodes)
+	li, ni := 0, leaves
+	pop := func() int {
+		if li < leaves && (ni >= len(nodes) || nodes[li].count <= nodes[ni].count) {
+			li++
+			return li - 1
+		}
+		ni++
+		return ni - 1
+	}
+	for len(nodes) < 2*leaves-1 {
+		a, b := pop(), pop()
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, left: a, right: b})
+	}
+
+	longest := 0
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if nodes[i].left < 0 {
+			lengths[nodes[i].symbol] = uint8(depth)
+			longest = max(longest, depth)
+			return
+		}
+		walk(nodes[i].left, depth+1)
+		walk(nodes[i].right, depth+1)
+	}
+	walk(len(nodes)-1, 0)
+	return lengths, longest
+}
+
+// canonicalCode assigns canonical codes to lengths. A code with a single
+// symbol takes no bits.
+func canonicalCode(lengths []uint8) prefixCode {
+	code := prefixCode{codes: make([]uint32, len(lengths)), lengths: slices.Clone(lengths)}
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	if used <= 1 {
+		clear(code.lengths)
+		return code
+	}
+
+	var count [16]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [16]uint32
+	c := uint32(0)
+	for l := 1; l < 16; l++ {
+		c = (c + count[l-1]) << 1
+		next[l] = c
+	}
+	for s, l := range lengths {
+		if l > 0 {
+			code.codes[s] = bits.Reverse32(next[l]) >> (32 - l)
+			next[l]++
+		}
+	}
+	return code
+}
+
+// bitWriter packs bits least significant first.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
@@ -0,0 +1,88 @@
+package gif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// playWebP decodes each frame of an animated WebP as a still WebP of its own
+// and composites it as its ANMF chunk says.
+func playWebP(t *testing.T, data []byte) (frames []shownFrame, plays int) {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		t.Fatal("not a WebP file")
+	}
+	if n := int(binary.LittleEndian.Uint32(data[4:])); n != len(data)-8 {
+		t.Fatalf("RIFF size %d, want %d", n, len(data)-8)
+	}
+	uint24 := func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 }
+
+	var canvas *image.NRGBA
+	for b := data[12:]; len(b) >= 8; {
+		n := int(binary.LittleEndian.Uint32(b[4:]))
+		typ, body := string(b[:4]), b[8:8+n]
+		b = b[8+n+n%2:]
+		switch typ {
+		case "VP8X":
+			canvas = image.NewNRGBA(image.Rect(0, 0, uint24(body[4:])+1, uint24(body[7:])+1))
+		case "ANIM":
+			plays = int(binary.LittleEndian.Uint16(body[4:]))
+		case "ANMF":
+			x, y := 2*uint24(body), 2*uint24(body[3:])
+			rect := image.Rect(x, y, x+uint24(body[6:])+1, y+uint24(body[9:])+1)
+			duration, flags := uint24(body[12:]), body[15]
+
+			// Wrap the frame's VP8L chunk in a file of its own
+			var still bytes.Buffer
+			still.WriteString("RIFF")
+			binary.Write(&still, binary.LittleEndian, uint32(4+len(body)-16))
+			still.WriteString("WEBP")
+			still.Write(body[16:])
+			img, err := webp.Decode(&still)
+			if err != nil {
+				t.Fatalf("frame %d: %v", len(frames), err)
+			}
+			if img.Bounds().Size() != rect.Size() {
+				t.Fatalf("frame %d: %v image for a %v frame", len(frames), img.Bounds(), rect)
+			}
+
+			op := draw.Over
+			if flags&0x02 != 0 {
+				op = draw.Src
+			}
+			draw.Draw(canvas, rect, img, img.Bounds().Min, op)
+			snapshot := image.NewNRGBA(canvas.Rect)
+			copy(snapshot.Pix, canvas.Pix)
+			frames = append(frames, shownFrame{snapshot, duration / 10})
+			if flags&0x01 != 0 {
+				draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+			}
+		}
+	}
+	return frames, plays
+}
+
+func TestWebPRoundTrip(t *testing.T) {
+	for name, a := range map[string]*Animation{
+		"frames":   testAnimation(),
+		"rendered": renderedAnimation(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := a.Encode(&buf, FormatWebP); err != nil {
+				t.Fatal(err)
+			}
+			frames, plays := playWebP(t, buf.Bytes())
+			// Frames that change nothing are folded into the one before
+			compareFrames(t, frames, merge(play(a)))
+			if plays != a.Plays {
+				t.Errorf("plays %d, want %d", plays, a.Plays)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package private
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+
+	"gif-service/gif"
+	"gif-service/middleware"
+	"gif-service/queries"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxBackgroundSize      = 5 << 20 // 5 MB
+	maxBackgroundDimension = 4096
+	maxUserBackgrounds     = 20
+)
+
+var backgroundContentTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+}
+
+var backgroundUploads = uploadKind{
+	noun:     "background image",
+	maxSize:  maxBackgroundSize,
+	maxCount: maxUserBackgrounds,
+	count:    queries.CountBackgroundImages,
+	storageKey: func(db *gorm.DB, id, userID string) (string, error) {
+		bg, err := queries.GetUserBackgroundImage(db, id, userID)
+		if err != nil {
+			return "", err
+		}
+		return bg.StorageKey, nil
+	},
+	remove: queries.DeleteBackgroundImage,
+	forget: gif.ForgetImage,
+}
+
+// UploadBackground accepts a multipart "file" field holding a PNG or JPEG
+// background image, with an optional "name" field (defaults to the file
+// name).
+func UploadBackground(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+
+	data, filename, ok := backgroundUploads.read(w, r)
+	if !ok {
+		return
+	}
+
+	// Check the dimensions before decoding, so a small file cannot expand
+	// into a huge image.
+	imgCfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	contentType, ok := backgroundContentTypes[format]
+	if err != nil || !ok {
+		http.Error(w, "Image must be a PNG or JPEG file", http.StatusBadRequest)
+		return
+	}
+	if imgCfg.Width > maxBackgroundDimension || imgCfg.Height > maxBackgroundDimension {
+		http.Error(w, "Image must be at most 4096x4096 pixels", http.StatusBadRequest)
+		return
+	}
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		http.Error(w, "Image could not be decoded", http.StatusBadRequest)
+		return
+	}
+	name := uploadName(r, "", filename)
+
+	if !backgroundUploads.checkQuota(w, userID) {
+		return
+	}
+
+	bg, err := queries.CreateBackgroundImage(db, userID, name, format, imgCfg.Width, imgCfg.Height, len(data))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	backgroundUploads.store(w, userID, bg.ID, bg.StorageKey, data, contentType, bg)
+}
+
+func ListBackgrounds(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+
+	images, err := queries.ListBackgroundImages(db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images)
+}
+
+func DeleteBackground(w http.ResponseWriter, r *http.Request) {
+	backgroundUploads.delete(w, r)
+}
+
+// LoadBackground fetches an uploaded background image's file by its ID. It
+// is registered with gif.SetImageLoader so templates can name images at
+// render time.
+func LoadBackground(id string) ([]byte, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errors.New("not a background image id")
+	}
+
+	bg, err := queries.GetBackgroundImageById(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Get(bg.StorageKey)
+}
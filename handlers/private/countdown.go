@@ -3,13 +3,12 @@ package private
 import (
 	"encoding/json"
 	"fmt"
-	"image/color"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"gif-service/gif"
+	"gif-service/handlers"
 	"gif-service/internal/models"
 	"gif-service/internal/storage"
 	"gif-service/middleware"
@@ -20,26 +19,28 @@ import (
 )
 
 var db *gorm.DB
-var r2Client *storage.R2Client
+var store storage.Store
 
 func SetDB(database *gorm.DB) {
 	db = database
 }
 
-func SetR2Client(client *storage.R2Client) {
-	r2Client = client
+func SetStore(s storage.Store) {
+	store = s
 }
 
 type CreateCountdownRequest struct {
 	Name string `json:"name"`
 
-	// Timer config
-	TimerType string `json:"timer_type,omitempty"`
-	EndTime   string `json:"end_time,omitempty"`
-	Duration  *int   `json:"duration,omitempty"`
+	// Timer config. With time_zone, end_time is a wall-clock time there.
+	TimerType     string `json:"timer_type,omitempty"`
+	EndTime       string `json:"end_time,omitempty"`
+	TimeZone      string `json:"time_zone,omitempty"`
+	RecipientZone bool   `json:"recipient_zone,omitempty"`
+	Duration      *int   `json:"duration,omitempty"`
 
-	// Style config (full JSON for GIF generator)
-	StyleConfig map[string]interface{} `json:"style_config,omitempty"`
+	// Style config, decoded by gif.ParseStyle; defaults when left out
+	StyleConfig json.RawMessage `json:"style_config,omitempty"`
 }
 
 type UpdateCountdownRequest struct {
@@ -63,6 +64,23 @@ func CreateCountdown(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	style, err := parseStyle(req.StyleConfig)
+	if err != nil {
+		http.Error(w, "Invalid style_config", http.StatusBadRequest)
+		return
+	}
+	if err := validateStyle(style, userID); err != nil {
+		handlers.WriteStyleError(w, err)
+		return
+	}
+
+	deadline, err := parseDeadline(req.EndTime, req.TimeZone)
+	if err != nil {
+		writeDeadlineError(w, err)
+		return
+	}
+	endTime := deadline.endTime
+
 	// Determine countdown type
 	countdownType := models.CountdownTypeEvent
 	if req.TimerType == "on_send" {
@@ -71,38 +89,27 @@ func CreateCountdown(w http.ResponseWriter, r *http.Request) {
 		countdownType = models.CountdownTypeHoliday
 	}
 
-	// Parse end time
-	var endTime *time.Time
-	if req.EndTime != "" {
-		parsed, err := time.Parse(time.RFC3339, req.EndTime)
-		if err == nil {
-			endTime = &parsed
-		}
-	}
-
-	countdown, err := queries.CreateCountdownFull(db, userID, req.Name, countdownType, endTime, req.Duration)
+	countdown, err := queries.CreateCountdownFull(db, userID, models.Countdown{
+		Name:          req.Name,
+		Type:          countdownType,
+		EndTime:       endTime,
+		LocalEndTime:  deadline.local,
+		TimeZone:      deadline.zone,
+		RecipientZone: deadline.recipientZone(req.RecipientZone),
+		Duration:      req.Duration,
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Serialize style config to JSON
-	styleConfigJSON := ""
-	if req.StyleConfig != nil {
-		scBytes, err := json.Marshal(req.StyleConfig)
-		if err == nil {
-			styleConfigJSON = string(scBytes)
-		}
-	}
-
-	_, err = queries.CreateTemplateWithStyle(db, countdown.ID, styleConfigJSON)
+	_, err = queries.CreateTemplateWithStyle(db, countdown.ID, encodeStyle(style))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Build GIF config from style config or use defaults
-	gifCfg := buildGIFConfigFromStyle(req.StyleConfig)
+	gifCfg := style.Config()
 
 	// Set end time for GIF generation
 	if endTime != nil {
@@ -122,15 +129,15 @@ func CreateCountdown(w http.ResponseWriter, r *http.Request) {
 	}
 
 	key := fmt.Sprintf("previews/%s.gif", countdown.ID)
-	if err := r2Client.UploadGIF(key, gifBytes); err != nil {
-		log.Printf("R2 Upload Error: %v", err)
+	if err := store.Put(key, gifBytes, "image/gif"); err != nil {
+		log.Printf("Storage Upload Error: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to upload GIF: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	previewURL := fmt.Sprintf("%s/%s", os.Getenv("R2_PUBLIC_URL"), key)
+	previewURL := store.URL(key)
 
-	queries.UpdateCountdown(db, countdown.ID, map[string]interface{}{
+	queries.UpdateCountdown(db, countdown.ID, userID, map[string]interface{}{
 		"preview_url": previewURL,
 	})
 
@@ -141,108 +148,18 @@ func CreateCountdown(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(countdown)
 }
 
-func buildGIFConfigFromStyle(style map[string]interface{}) gif.Config {
-	cfg := gif.Config{
-		Background:     color.RGBA{R: 255, G: 255, B: 255, A: 255},
-		TextColor:      color.RGBA{R: 0, G: 0, B: 0, A: 255},
-		NumberFontSize: 60,
-		ShowLabels:     true,
-		LabelFontSize:  14,
-		LabelColor:     color.RGBA{R: 0, G: 0, B: 0, A: 255},
-		ShowSeparators: true,
-		SeparatorColor: color.RGBA{R: 0, G: 0, B: 0, A: 255},
-		ShowDays:       true,
-		ShowHours:      true,
-		ShowMinutes:    true,
-		ShowSeconds:    true,
-	}
-
-	if style == nil {
-		return cfg
-	}
-
-	// Parse colors
-	if v, ok := style["number_color"].(string); ok && v != "" {
-		cfg.TextColor = parseColorFallback(v, cfg.TextColor)
-	}
-	if v, ok := style["bg_color"].(string); ok && v != "" {
-		cfg.Background = parseColorFallback(v, cfg.Background)
-	}
-	if v, ok := style["label_color"].(string); ok && v != "" {
-		cfg.LabelColor = parseColorFallback(v, cfg.LabelColor)
-	}
-	if v, ok := style["separator_color"].(string); ok && v != "" {
-		cfg.SeparatorColor = parseColorFallback(v, cfg.SeparatorColor)
-	}
-
-	// Parse fonts
-	if v, ok := style["number_font"].(string); ok {
-		cfg.NumberFontName = v
-	}
-	if v, ok := style["label_font"].(string); ok {
-		cfg.LabelFontName = v
-	}
-
-	// Parse sizes
-	if v, ok := style["number_font_size"].(float64); ok && v > 0 {
-		cfg.NumberFontSize = v
-	}
-	if v, ok := style["label_font_size"].(float64); ok && v > 0 {
-		cfg.LabelFontSize = v
-	}
-
-	// Parse booleans
-	if v, ok := style["show_labels"].(bool); ok {
-		cfg.ShowLabels = v
-	}
-	if v, ok := style["show_separators"].(bool); ok {
-		cfg.ShowSeparators = v
-	}
-	if v, ok := style["show_days"].(bool); ok {
-		cfg.ShowDays = v
-	}
-	if v, ok := style["show_hours"].(bool); ok {
-		cfg.ShowHours = v
-	}
-	if v, ok := style["show_minutes"].(bool); ok {
-		cfg.ShowMinutes = v
-	}
-	if v, ok := style["show_seconds"].(bool); ok {
-		cfg.ShowSeconds = v
-	}
-	if v, ok := style["transparent"].(bool); ok {
-		cfg.Transparent = v
-	}
-	if v, ok := style["rounded_corners"].(bool); ok {
-		cfg.RoundedCorners = v
-	}
-	if v, ok := style["corner_radius"].(float64); ok {
-		cfg.CornerRadius = int(v)
-	}
-
-	return cfg
-}
-
-func parseColorFallback(hex string, fallback color.Color) color.Color {
-	if hex == "" {
-		return fallback
-	}
-	c, err := parseHexColor(hex)
-	if err != nil {
-		return fallback
-	}
-	return c
-}
-
 type SaveCountdownRequest struct {
-	Name        string                 `json:"name"`
-	TimerType   string                 `json:"timer_type,omitempty"`
-	EndTime     string                 `json:"end_time,omitempty"`
-	Duration    *int                   `json:"duration,omitempty"`
-	StyleConfig map[string]interface{} `json:"style_config,omitempty"`
+	Name          string          `json:"name"`
+	TimerType     string          `json:"timer_type,omitempty"`
+	EndTime       string          `json:"end_time,omitempty"`
+	TimeZone      string          `json:"time_zone,omitempty"` // with it, end_time is a wall-clock time there
+	RecipientZone bool            `json:"recipient_zone,omitempty"`
+	Duration      *int            `json:"duration,omitempty"`
+	StyleConfig   json.RawMessage `json:"style_config,omitempty"` // keeps the saved style when left out
 }
 
 func SaveExistingCountdown(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
 	id := chi.URLParam(r, "id")
 
 	var req SaveCountdownRequest
@@ -251,6 +168,23 @@ func SaveExistingCountdown(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	style, err := parseStyle(req.StyleConfig)
+	if err != nil {
+		http.Error(w, "Invalid style_config", http.StatusBadRequest)
+		return
+	}
+	if err := validateStyle(style, userID); err != nil {
+		handlers.WriteStyleError(w, err)
+		return
+	}
+
+	deadline, err := parseDeadline(req.EndTime, req.TimeZone)
+	if err != nil {
+		writeDeadlineError(w, err)
+		return
+	}
+	endTime := deadline.endTime
+
 	// Update countdown fields
 	countdownType := models.CountdownTypeEvent
 	if req.TimerType == "on_send" {
@@ -259,14 +193,6 @@ func SaveExistingCountdown(w http.ResponseWriter, r *http.Request) {
 		countdownType = models.CountdownTypeHoliday
 	}
 
-	var endTime *time.Time
-	if req.EndTime != "" {
-		parsed, err := time.Parse(time.RFC3339, req.EndTime)
-		if err == nil {
-			endTime = &parsed
-		}
-	}
-
 	updates := map[string]interface{}{
 		"type": countdownType,
 	}
@@ -274,39 +200,47 @@ func SaveExistingCountdown(w http.ResponseWriter, r *http.Request) {
 		updates["name"] = req.Name
 	}
 	if endTime != nil {
+		// A new end time replaces the wall-clock deadline, if any
 		updates["end_time"] = endTime
+		updates["local_end_time"] = deadline.local
+		updates["time_zone"] = deadline.zone
+		updates["recipient_zone"] = deadline.recipientZone(req.RecipientZone)
 	}
 	if req.Duration != nil {
 		updates["duration"] = *req.Duration
 	}
 
-	if err := queries.UpdateCountdown(db, id, updates); err != nil {
+	if err := queries.UpdateCountdown(db, id, userID, updates); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "countdown not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Update template style config
-	styleConfigJSON := ""
-	if req.StyleConfig != nil {
-		scBytes, err := json.Marshal(req.StyleConfig)
-		if err == nil {
-			styleConfigJSON = string(scBytes)
-		}
-	}
-
-	template, err := queries.GetTemplate(db, id)
+	template, err := queries.GetUserTemplate(db, id, userID)
 	if err != nil {
-		http.Error(w, "Template not found", http.StatusInternalServerError)
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := queries.UpdateTemplate(db, template.ID, &models.Template{StyleConfig: styleConfigJSON}); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	// Update template style config, or regenerate from the saved one
+	if req.StyleConfig != nil {
+		if err := queries.UpdateTemplate(db, template.ID, userID, &models.Template{StyleConfig: encodeStyle(style)}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if style, err = gif.MigrateStyle(template.StyleConfig); err != nil {
+		log.Printf("Invalid style config for countdown %s: %v", id, err)
 	}
 
 	// Regenerate GIF
-	gifCfg := buildGIFConfigFromStyle(req.StyleConfig)
+	gifCfg := style.Config()
 	if endTime != nil {
 		gifCfg.EndTime = *endTime
 	} else if req.Duration != nil {
@@ -323,23 +257,24 @@ func SaveExistingCountdown(w http.ResponseWriter, r *http.Request) {
 	}
 
 	key := fmt.Sprintf("previews/%s.gif", id)
-	if err := r2Client.UploadGIF(key, gifBytes); err != nil {
-		log.Printf("R2 Upload Error: %v", err)
+	if err := store.Put(key, gifBytes, "image/gif"); err != nil {
+		log.Printf("Storage Upload Error: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to upload GIF: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	previewURL := fmt.Sprintf("%s/%s", os.Getenv("R2_PUBLIC_URL"), key)
-	queries.UpdateCountdown(db, id, map[string]interface{}{"preview_url": previewURL})
+	previewURL := store.URL(key)
+	queries.UpdateCountdown(db, id, userID, map[string]interface{}{"preview_url": previewURL})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"id": id, "preview_url": previewURL})
 }
 
 func GetCountdown(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
 	id := chi.URLParam(r, "id")
 
-	countdown, err := queries.GetCountdownById(db, id)
+	countdown, err := queries.GetUserCountdownById(db, id, userID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			http.Error(w, "countdown not found", http.StatusNotFound)
@@ -382,9 +317,10 @@ func ListCountdowns(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteCountdown(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
 	id := chi.URLParam(r, "id")
 
-	err := queries.DeleteCountdown(db, id)
+	err := queries.DeleteCountdown(db, id, userID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			http.Error(w, "countdown not found", http.StatusNotFound)
@@ -395,15 +331,35 @@ func DeleteCountdown(w http.ResponseWriter, r *http.Request) {
 	}
 
 	key := fmt.Sprintf("previews/%s.gif", id)
-	if err := r2Client.DeleteObject(key); err != nil {
-		log.Printf("R2 Delete Error for %s: %v", id, err)
+	if err := store.Delete(key); err != nil {
+		log.Printf("Storage Delete Error for %s: %v", id, err)
 		// We don't return error here because the DB record is already deleted
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// StartCountdown marks an on_send countdown as sent, anchoring its timer at
+// the current time.
+func StartCountdown(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	id := chi.URLParam(r, "id")
+
+	err := queries.StartCountdown(db, id, userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "on_send countdown not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func UpdateCountdown(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
 	id := chi.URLParam(r, "id")
 
 	var req UpdateCountdownRequest
@@ -433,7 +389,7 @@ func UpdateCountdown(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := queries.UpdateCountdown(db, id, updates)
+	err := queries.UpdateCountdown(db, id, userID, updates)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			http.Error(w, "countdown not found", http.StatusNotFound)
@@ -0,0 +1,74 @@
+package private
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"gif-service/internal/deadline"
+)
+
+var (
+	errInvalidEndTime  = errors.New("invalid end_time format")
+	errInvalidTimeZone = errors.New("invalid time_zone")
+	errEndTimeRequired = errors.New("end_time is required with time_zone")
+)
+
+// deadlineMessages are what clients are told for each parseDeadline error.
+var deadlineMessages = map[error]string{
+	errInvalidEndTime:  "Invalid end_time format",
+	errInvalidTimeZone: "Invalid time_zone",
+	errEndTimeRequired: "end_time is required with time_zone",
+}
+
+// timerDeadline is a fixed timer's deadline as given in a request.
+type timerDeadline struct {
+	endTime *time.Time // nil when no end_time was given
+	local   string     // end_time in deadline.Layout, when given with a zone
+	zone    string
+}
+
+// recipientZone reports whether the deadline is read in each recipient's
+// zone, as requested. Only wall-clock deadlines can be.
+func (d timerDeadline) recipientZone(requested bool) bool {
+	return requested && d.zone != ""
+}
+
+// parseDeadline reads end_time as an RFC3339 instant or, when zone is set,
+// as a wall-clock time in that IANA zone, such as "2026-11-27T23:59" in
+// "America/New_York". Its errors are reported with writeDeadlineError.
+func parseDeadline(endTime, zone string) (timerDeadline, error) {
+	if zone == "" {
+		if endTime == "" {
+			return timerDeadline{}, nil
+		}
+		parsed, err := time.Parse(time.RFC3339, endTime)
+		if err != nil {
+			return timerDeadline{}, errInvalidEndTime
+		}
+		return timerDeadline{endTime: &parsed}, nil
+	}
+
+	loc, err := deadline.LoadZone(zone)
+	if err != nil {
+		return timerDeadline{}, errInvalidTimeZone
+	}
+	if endTime == "" {
+		return timerDeadline{}, errEndTimeRequired
+	}
+	wall, err := deadline.ParseWallClock(endTime)
+	if err != nil {
+		return timerDeadline{}, errInvalidEndTime
+	}
+	resolved := deadline.In(wall, loc)
+	return timerDeadline{endTime: &resolved, local: wall.Format(deadline.Layout), zone: zone}, nil
+}
+
+// writeDeadlineError responds 400 to a parseDeadline error.
+func writeDeadlineError(w http.ResponseWriter, err error) {
+	msg, ok := deadlineMessages[err]
+	if !ok {
+		msg = err.Error()
+	}
+	http.Error(w, msg, http.StatusBadRequest)
+}
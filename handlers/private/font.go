@@ -0,0 +1,125 @@
+package private
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"gif-service/gif"
+	"gif-service/internal/models"
+	"gif-service/middleware"
+	"gif-service/queries"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxFontSize  = 5 << 20 // 5 MB
+	maxUserFonts = 20
+)
+
+var fontContentTypes = map[string]string{
+	"ttf": "font/ttf",
+	"otf": "font/otf",
+}
+
+var fontUploads = uploadKind{
+	noun:     "font",
+	maxSize:  maxFontSize,
+	maxCount: maxUserFonts,
+	count:    queries.CountFonts,
+	storageKey: func(db *gorm.DB, id, userID string) (string, error) {
+		font, err := queries.GetUserFont(db, id, userID)
+		if err != nil {
+			return "", err
+		}
+		return font.StorageKey, nil
+	},
+	remove: queries.DeleteFont,
+	forget: gif.ForgetFont,
+}
+
+// UploadFont accepts a multipart "file" field holding a TTF or OTF font,
+// with an optional "name" field (defaults to the font's family name).
+func UploadFont(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+
+	data, filename, ok := fontUploads.read(w, r)
+	if !ok {
+		return
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	contentType, ok := fontContentTypes[format]
+	if !ok {
+		http.Error(w, "Font must be a .ttf or .otf file", http.StatusBadRequest)
+		return
+	}
+
+	// Only TrueType outlines can be rendered, which rules out CFF-based OTFs.
+	parsed, err := truetype.Parse(data)
+	if err != nil {
+		http.Error(w, "Font could not be parsed; only TrueType-outline fonts are supported", http.StatusBadRequest)
+		return
+	}
+	name := uploadName(r, parsed.Name(truetype.NameIDFontFamily), filename)
+
+	if !fontUploads.checkQuota(w, userID) {
+		return
+	}
+
+	font, err := queries.CreateFont(db, userID, name, format, len(data))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fontUploads.store(w, userID, font.ID, font.StorageKey, data, contentType, font)
+}
+
+type ListFontsResponse struct {
+	Catalog []gif.FontFamilyInfo `json:"catalog"`
+	Custom  []models.Font        `json:"custom"`
+}
+
+// ListFonts returns the bundled font catalog alongside the user's uploads.
+func ListFonts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+
+	fonts, err := queries.ListFonts(db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListFontsResponse{
+		Catalog: gif.Catalog(),
+		Custom:  fonts,
+	})
+}
+
+func DeleteFont(w http.ResponseWriter, r *http.Request) {
+	fontUploads.delete(w, r)
+}
+
+// LoadFont fetches an uploaded font's file by its ID. It is registered with
+// gif.SetFontLoader so templates can name user fonts at render time.
+func LoadFont(id string) ([]byte, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, gif.ErrUnknownFont
+	}
+
+	font, err := queries.GetFontById(db, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, gif.ErrUnknownFont
+		}
+		return nil, err
+	}
+
+	return store.Get(font.StorageKey)
+}
@@ -0,0 +1,64 @@
+package private
+
+import (
+	"encoding/json"
+
+	"gif-service/gif"
+	"gif-service/queries"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// parseStyle decodes a style_config sent by a client. A missing one is the
+// default style.
+func parseStyle(raw json.RawMessage) (gif.StyleConfig, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return gif.DefaultStyle(), nil
+	}
+	return gif.ParseStyle(raw)
+}
+
+// validateStyle checks style, including that its background image and any
+// uploaded fonts it names are the user's own. Problems with the style itself
+// are reported as gif.ValidationErrors; any other error is the server's.
+func validateStyle(style gif.StyleConfig, userID string) error {
+	errs, _ := style.Validate().(gif.ValidationErrors)
+	if style.BgImage != "" {
+		if _, err := queries.GetUserBackgroundImage(db, style.BgImage, userID); err != nil {
+			if err != gorm.ErrRecordNotFound {
+				return err
+			}
+			errs = append(errs, gif.FieldError{Field: "bg_image", Message: "background image not found"})
+		}
+	}
+	fonts := []struct{ field, name string }{
+		{"number_font", style.NumberFont},
+		{"label_font", style.LabelFont},
+		{"expire_text_font", style.ExpireTextFont},
+	}
+	for _, f := range fonts {
+		// Other names are catalog faces or fall back to one
+		if _, err := uuid.Parse(f.name); err != nil {
+			continue
+		}
+		if _, err := queries.GetUserFont(db, f.name, userID); err != nil {
+			if err != gorm.ErrRecordNotFound {
+				return err
+			}
+			errs = append(errs, gif.FieldError{Field: f.field, Message: "font not found"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// encodeStyle serializes style for Template.StyleConfig, stamped with the
+// current schema version.
+func encodeStyle(style gif.StyleConfig) string {
+	style.Version = gif.StyleVersion
+	data, _ := json.Marshal(style)
+	return string(data)
+}
@@ -2,7 +2,10 @@ package private
 
 import (
 	"encoding/json"
+	"gif-service/gif"
+	"gif-service/handlers"
 	"gif-service/internal/models"
+	"gif-service/middleware"
 	"gif-service/queries"
 	"net/http"
 
@@ -11,9 +14,10 @@ import (
 )
 
 func GetTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
 	countdownID := chi.URLParam(r, "countdown_id")
 
-	template, err := queries.GetTemplate(db, countdownID)
+	template, err := queries.GetUserTemplate(db, countdownID, userID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			http.Error(w, "template not found", http.StatusNotFound)
@@ -28,6 +32,7 @@ func GetTemplate(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
 	id := chi.URLParam(r, "id")
 
 	var updates models.Template
@@ -37,7 +42,24 @@ func UpdateTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := queries.UpdateTemplate(db, id, &updates)
+	// A template cannot be re-pointed at another countdown
+	updates.ID = ""
+	updates.CountdownID = ""
+
+	if updates.StyleConfig != "" {
+		style, err := gif.ParseStyle([]byte(updates.StyleConfig))
+		if err != nil {
+			http.Error(w, "Invalid style_config", http.StatusBadRequest)
+			return
+		}
+		if err := validateStyle(style, userID); err != nil {
+			handlers.WriteStyleError(w, err)
+			return
+		}
+		updates.StyleConfig = encodeStyle(style)
+	}
+
+	err := queries.UpdateTemplate(db, id, userID, &updates)
 
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -0,0 +1,128 @@
+package private
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"gif-service/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// uploadKind is a kind of file users upload for their templates, such as
+// fonts, kept as a database record and a file in the store.
+type uploadKind struct {
+	noun     string // in messages, e.g. "font"
+	maxSize  int
+	maxCount int64
+
+	count func(db *gorm.DB, userID string) (int64, error)
+	// storageKey returns where the user's upload is stored.
+	storageKey func(db *gorm.DB, id, userID string) (string, error)
+	remove     func(db *gorm.DB, id, userID string) error
+	// forget drops anything cached for the upload at render time.
+	forget func(id string)
+}
+
+// read returns the data and file name of the multipart "file" field. On
+// failure it writes the error and returns false.
+func (k uploadKind) read(w http.ResponseWriter, r *http.Request) ([]byte, string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(k.maxSize)+1<<20)
+	if err := r.ParseMultipartForm(int64(k.maxSize)); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid upload: expected multipart form under %d MB", k.maxSize>>20), http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return nil, "", false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(k.maxSize)+1))
+	if err != nil {
+		http.Error(w, "Failed to read upload", http.StatusBadRequest)
+		return nil, "", false
+	}
+	if len(data) > k.maxSize {
+		http.Error(w, fmt.Sprintf("File must be under %d MB", k.maxSize>>20), http.StatusBadRequest)
+		return nil, "", false
+	}
+	return data, header.Filename, true
+}
+
+// uploadName returns the trimmed "name" form field, or failing that
+// fallback, or the file name without its extension.
+func uploadName(r *http.Request, fallback, filename string) string {
+	if name := strings.TrimSpace(r.FormValue("name")); name != "" {
+		return name
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
+// checkQuota reports whether the user has room for another upload, writing
+// the error if not.
+func (k uploadKind) checkQuota(w http.ResponseWriter, userID string) bool {
+	count, err := k.count(db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if count >= k.maxCount {
+		http.Error(w, fmt.Sprintf("Maximum of %d %ss reached", k.maxCount, k.noun), http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// store puts the file of a newly created record and writes the record as
+// the response. If the file cannot be stored the record is removed.
+func (k uploadKind) store(w http.ResponseWriter, userID, id, key string, data []byte, contentType string, record any) {
+	if err := store.Put(key, data, contentType); err != nil {
+		log.Printf("Storage Upload Error: %v", err)
+		k.remove(db, id, userID)
+		http.Error(w, "Failed to store "+k.noun, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(record)
+}
+
+// delete deletes the upload named by the "id" URL parameter, then its file.
+func (k uploadKind) delete(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(string)
+	id := chi.URLParam(r, "id")
+
+	key, err := k.storageKey(db, id, userID)
+	if err == nil {
+		err = k.remove(db, id, userID)
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, k.noun+" not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The record is gone, so a file left behind is only logged
+	if err := store.Delete(key); err != nil {
+		log.Printf("Storage Delete Error for %s %s: %v", k.noun, id, err)
+	}
+	k.forget(id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,11 +3,17 @@ package public
 import (
 	"encoding/json"
 	"fmt"
-	"image/color"
 	"net/http"
 	"time"
 
 	"gif-service/gif"
+	"gif-service/handlers"
+)
+
+// The size of the default timer: horizontal, at the default font size.
+const (
+	generateWidth  = 534
+	generateHeight = 143
 )
 
 type GenerateRequest struct {
@@ -26,60 +32,61 @@ type ColorConfig struct {
 	Text       string `json:"text"`
 }
 
+// style converts the request to a gif.StyleConfig. The timer has no labels
+// or separators, as this endpoint always drew it.
+func (req GenerateRequest) style() gif.StyleConfig {
+	style := gif.DefaultStyle()
+	style.ShowLabels = false
+	style.ShowSeparators = false
+	style.Layout = req.Template.Layout
+	style.NumberFontSize = float64(req.Template.FontSize)
+	style.BgColor = req.Colors.Background
+	style.NumberColor = req.Colors.Text
+	return style
+}
+
 func Generate(w http.ResponseWriter, r *http.Request) {
 	var req GenerateRequest
 
-	err := json.NewDecoder(r.Body).Decode(&req)
+	format, err := gif.PickFormat(r.URL.Query().Get("format"), r.Header.Get("Accept"))
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Invalid format", http.StatusBadRequest)
 		return
 	}
 
-	endTime, err := time.Parse(time.RFC3339, req.EndTime)
+	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, "Invalid endTime format", http.StatusBadRequest)
-		return
-	}
-
-	bgColor, err := parseHexColor(req.Colors.Background)
-	if err != nil {
-		http.Error(w, "Invalid background color", http.StatusBadRequest)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	textColor, err := parseHexColor(req.Colors.Text)
+	endTime, err := time.Parse(time.RFC3339, req.EndTime)
 	if err != nil {
-		http.Error(w, "Invalid text color", http.StatusBadRequest)
+		http.Error(w, "Invalid endTime format", http.StatusBadRequest)
 		return
 	}
 
-	gifBytes, err := gif.Generate(gif.Config{
-		EndTime:    endTime,
-		Background: bgColor,
-		TextColor:  textColor,
-		Width:      534,
-		Height:     143,
-	})
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to generate GIF: %v", err), http.StatusInternalServerError)
+	style := req.style()
+	if err := style.Validate(); err != nil {
+		handlers.WriteStyleError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/gif")
-	w.Write(gifBytes)
-}
-
-func parseHexColor(hex string) (color.Color, error) {
-	var r, g, b uint8
-
-	if hex[0] == '#' {
-		hex = hex[1:]
+	cfg := style.Config()
+	cfg.EndTime = endTime
+	if req.Template.FontSize == 0 && (style.Layout == "" || style.Layout == gif.LayoutHorizontal) {
+		// The default timer keeps the size this endpoint has always
+		// returned; others are sized to fit.
+		cfg.Width, cfg.Height = generateWidth, generateHeight
 	}
 
-	_, err := fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b)
+	imgBytes, err := gif.GenerateFormat(cfg, format)
 	if err != nil {
-		return nil, err
+		http.Error(w, fmt.Sprintf("Failed to generate image: %v", err), http.StatusInternalServerError)
+		return
 	}
 
-	return color.RGBA{R: r, G: g, B: b, A: 255}, nil
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Vary", "Accept")
+	w.Write(imgBytes)
 }
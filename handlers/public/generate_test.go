@@ -0,0 +1,70 @@
+package public
+
+import (
+	"bytes"
+	"fmt"
+	"image/gif"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	timer "gif-service/gif"
+)
+
+func TestMain(m *testing.M) {
+	if err := timer.LoadFonts(filepath.Join("..", "..", "fonts")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestGenerateSize(t *testing.T) {
+	tests := []struct {
+		fontSize int
+		layout   string
+	}{
+		{0, ""},
+		{0, "vertical"},
+		{40, ""},
+		{100, ""},
+		{150, "horizontal"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d %s", tt.fontSize, tt.layout), func(t *testing.T) {
+			req := GenerateRequest{
+				EndTime:  "2030-01-01T00:00:00Z",
+				Template: TemplateConfig{FontSize: tt.fontSize, Layout: tt.layout},
+				Colors:   ColorConfig{Background: "#ffffff", Text: "#000000"},
+			}
+			body := fmt.Sprintf(`{"endTime":%q,"template":{"fontSize":%d,"layout":%q},"colors":{"background":"#ffffff","text":"#000000"}}`,
+				req.EndTime, tt.fontSize, tt.layout)
+			w := httptest.NewRecorder()
+			Generate(w, httptest.NewRequest("POST", "/generate", strings.NewReader(body)))
+			if w.Code != 200 {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			img, err := gif.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.fontSize == 0 && tt.layout == "" {
+				if img.Width != generateWidth || img.Height != generateHeight {
+					t.Errorf("default timer is %dx%d, want %dx%d", img.Width, img.Height, generateWidth, generateHeight)
+				}
+				return
+			}
+			// Anything else is at least as large as its digits need
+			cfg := req.style().Config()
+			cfg.EndTime, _ = time.Parse(time.RFC3339, req.EndTime)
+			cfg.CalcDimensions()
+			if img.Width < cfg.Width || img.Height < cfg.Height {
+				t.Errorf("timer is %dx%d, clipping digits that need %dx%d", img.Width, img.Height, cfg.Width, cfg.Height)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package public
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gif-service/gif"
+	"gif-service/internal/deadline"
+	"gif-service/internal/models"
+	"gif-service/queries"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+var db *gorm.DB
+
+// renderCache shares renders between recipients opening the same timer in
+// the same second.
+var renderCache = gif.NewRenderCache()
+
+func SetDB(database *gorm.DB) {
+	db = database
+}
+
+// RenderCountdown serves a freshly rendered image for a saved countdown. It
+// is meant to be embedded in emails, so the remaining time is computed when
+// the image is opened rather than when the countdown was saved. The format
+// is picked by renderFormat.
+func RenderCountdown(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	format, err := renderFormat(r)
+	if err != nil {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+	if len(r.URL.Query().Get("uid")) > maxRecipientUIDLength {
+		http.Error(w, fmt.Sprintf("uid must be at most %d characters", maxRecipientUIDLength), http.StatusBadRequest)
+		return
+	}
+
+	countdown, err := queries.GetCountdownById(db, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "countdown not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	template, err := queries.GetTemplate(db, countdown.ID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	style, err := gif.MigrateStyle(template.StyleConfig)
+	if err != nil {
+		log.Printf("Invalid style config for countdown %s: %v", countdown.ID, err)
+	}
+	if style.Layout == "" && gif.ValidLayout(template.Layout) {
+		style.Layout = template.Layout
+	}
+
+	now := time.Now()
+	endTime, err := resolveEndTime(countdown, r, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cfg := style.Config()
+	cfg.EndTime = endTime
+	cfg.Now = now
+	cfg.CalcDimensions()
+
+	imgBytes, err := renderCache.Generate(cfg, format)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to generate image: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := queries.IncrementCountdownViews(db, countdown.ID); err != nil {
+		log.Printf("Failed to record view for countdown %s: %v", countdown.ID, err)
+	}
+
+	// Email clients and image proxies must not reuse a stale render.
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Vary", "Accept, User-Agent")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, max-age=0")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Expires", "0")
+	w.Write(imgBytes)
+}
+
+// stillUserAgents are User-Agent fragments of email clients that only show
+// the first frame of an animation, such as Outlook on Windows.
+var stillUserAgents = []string{"Microsoft Outlook", "MSOffice", "Microsoft Office/"}
+
+// renderFormat picks the format named by ?format=, or else a PNG snapshot
+// for clients that would not animate the image, or else one negotiated
+// from the Accept header.
+func renderFormat(r *http.Request) (gif.Format, error) {
+	if v := r.URL.Query().Get("format"); v != "" {
+		return gif.ParseFormat(v)
+	}
+	ua := r.Header.Get("User-Agent")
+	for _, s := range stillUserAgents {
+		if strings.Contains(ua, s) {
+			return gif.FormatPNG, nil
+		}
+	}
+	return gif.NegotiateFormat(r.Header.Get("Accept")), nil
+}
+
+// RenderCacheStats reports the render cache counters.
+func RenderCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(renderCache.Stats())
+}
+
+// SpriteCacheStats reports the sprite cache counters.
+func SpriteCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gif.GetSpriteCacheStats())
+}
+
+// maxRecipientUIDLength bounds the ?uid= value stored per open; longer ones
+// are rejected.
+const maxRecipientUIDLength = 255
+
+// resolveEndTime works out when the countdown reaches zero, as seen at now.
+// For on_open countdowns opened with a ?uid= recipient identifier, the timer
+// runs Duration seconds from that recipient's first open. For on_send
+// countdowns it runs from ?sent_at= if given, otherwise from StartedAt. A
+// wall-clock deadline is resolved in its zone as of now, or in the ?tz= zone
+// for countdowns that end in the recipient's time zone.
+func resolveEndTime(countdown *models.Countdown, r *http.Request, now time.Time) (time.Time, error) {
+	if countdown.Type == models.CountdownTypeBirthday && countdown.Duration != nil {
+		start := now
+		if sentAt, ok := parseSentAt(r.URL.Query().Get("sent_at")); ok {
+			start = sentAt
+		} else if countdown.StartedAt != nil {
+			start = *countdown.StartedAt
+		}
+		return start.Add(time.Duration(*countdown.Duration) * time.Second), nil
+	}
+
+	if countdown.Type == models.CountdownTypeHoliday && countdown.Duration != nil {
+		start := now
+		if uid := r.URL.Query().Get("uid"); uid != "" {
+			open, err := queries.RecordCountdownOpen(db, countdown.ID, uid, now)
+			if err != nil {
+				return time.Time{}, err
+			}
+			start = open.FirstOpenedAt
+		}
+		return start.Add(time.Duration(*countdown.Duration) * time.Second), nil
+	}
+
+	if countdown.LocalEndTime != "" {
+		end, err := deadline.Resolve(countdown.LocalEndTime, recipientZone(countdown, r))
+		if err == nil {
+			return end, nil
+		}
+		log.Printf("Invalid deadline for countdown %s: %v", countdown.ID, err)
+	}
+
+	if countdown.EndTime != nil {
+		return *countdown.EndTime, nil
+	}
+	if countdown.Duration != nil {
+		return now.Add(time.Duration(*countdown.Duration) * time.Second), nil
+	}
+	return now.Add(24 * time.Hour), nil
+}
+
+// recipientZone returns the zone a wall-clock deadline is read in: the
+// recipient's ?tz= for countdowns that follow it, if it names a valid IANA
+// zone, otherwise the countdown's own.
+func recipientZone(countdown *models.Countdown, r *http.Request) string {
+	if countdown.RecipientZone {
+		if tz := r.URL.Query().Get("tz"); tz != "" {
+			if _, err := deadline.LoadZone(tz); err == nil {
+				return tz
+			}
+		}
+	}
+	return countdown.TimeZone
+}
+
+// parseSentAt accepts an RFC3339 timestamp or Unix seconds, since ESP merge
+// tags produce either.
+func parseSentAt(v string) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil && secs > 0 {
+		return time.Unix(secs, 0), true
+	}
+	return time.Time{}, false
+}
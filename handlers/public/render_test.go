@@ -0,0 +1,48 @@
+package public
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gif-service/internal/models"
+)
+
+func TestRecipientZone(t *testing.T) {
+	tests := []struct {
+		name          string
+		recipientZone bool
+		query         string
+		want          string
+	}{
+		{"recipient zone", true, "?tz=Europe/Berlin", "Europe/Berlin"},
+		{"recipient zone without tz", true, "", "America/New_York"},
+		{"recipient zone with invalid tz", true, "?tz=Nowhere/Special", "America/New_York"},
+		{"recipient zone with local tz", true, "?tz=Local", "America/New_York"},
+		{"fixed zone", false, "?tz=Europe/Berlin", "America/New_York"},
+		{"fixed zone without tz", false, "", "America/New_York"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			countdown := &models.Countdown{
+				LocalEndTime:  "2026-11-27T23:59:00",
+				TimeZone:      "America/New_York",
+				RecipientZone: tt.recipientZone,
+			}
+			r := httptest.NewRequest("GET", "/countdown.gif"+tt.query, nil)
+			if got := recipientZone(countdown, r); got != tt.want {
+				t.Errorf("recipientZone = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderCountdownRejectsLongUID(t *testing.T) {
+	r := httptest.NewRequest("GET", "/countdown.gif?uid="+strings.Repeat("x", maxRecipientUIDLength+1), nil)
+	w := httptest.NewRecorder()
+	RenderCountdown(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
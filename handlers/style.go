@@ -0,0 +1,26 @@
+// Package handlers holds what the public and private handlers share.
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"gif-service/gif"
+)
+
+// WriteStyleError responds to a style that failed validation: 400 with the
+// invalid fields as JSON, or 500 for a server error.
+func WriteStyleError(w http.ResponseWriter, err error) {
+	var errs gif.ValidationErrors
+	if !errors.As(err, &errs) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "Invalid style config",
+		"fields": errs,
+	})
+}
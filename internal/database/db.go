@@ -1,10 +1,13 @@
 package database
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 
+	"gif-service/gif"
 	"gif-service/internal/models"
 
 	"github.com/glebarez/sqlite"
@@ -34,9 +37,59 @@ func New(dbPath string) (*DB, error) {
 		&models.Template{},
 		&models.CountdownOpen{},
 		&models.ColorPalette{},
+		&models.Font{},
+		&models.BackgroundImage{},
 	); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// Recipient UIDs used to be unique across all countdowns; they are now
+	// unique per countdown (idx_countdown_open_recipient).
+	if db.Migrator().HasIndex(&models.CountdownOpen{}, "idx_countdown_recipient") {
+		if err := db.Migrator().DropIndex(&models.CountdownOpen{}, "idx_countdown_recipient"); err != nil {
+			return nil, fmt.Errorf("failed to drop legacy recipient index: %w", err)
+		}
+	}
+
+	if err := migrateStyleConfigs(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate style configs: %w", err)
+	}
+
 	return &DB{db}, nil
 }
+
+// migrateStyleConfigs upgrades stored template styles to the current
+// gif.StyleVersion. Styles that cannot be decoded are logged and left for
+// renders to fall back to defaults.
+func migrateStyleConfigs(db *gorm.DB) error {
+	var templates []models.Template
+	return db.Select("id", "layout", "style_config").FindInBatches(&templates, 200, func(_ *gorm.DB, _ int) error {
+		for _, t := range templates {
+			var stored struct {
+				Version int `json:"version"`
+			}
+			if json.Unmarshal([]byte(t.StyleConfig), &stored) == nil && stored.Version == gif.StyleVersion {
+				continue
+			}
+
+			style, err := gif.MigrateStyle(t.StyleConfig)
+			if err != nil {
+				log.Printf("Style config of template %s not migrated: %v", t.ID, err)
+				continue
+			}
+			// Layout used to live only in its own column
+			if style.Layout == "" && gif.ValidLayout(t.Layout) {
+				style.Layout = t.Layout
+			}
+
+			data, err := json.Marshal(style)
+			if err != nil {
+				return err
+			}
+			if err := db.Model(&models.Template{}).Where("id = ?", t.ID).Update("style_config", string(data)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
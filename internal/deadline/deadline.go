@@ -0,0 +1,63 @@
+// Package deadline resolves wall-clock countdown deadlines, such as Friday
+// 23:59 in America/New_York, to instants.
+package deadline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	// Zones resolve the same on hosts without a zoneinfo database, such as
+	// the alpine image the service ships in.
+	_ "time/tzdata"
+)
+
+// Layout is how wall-clock deadlines are stored.
+const Layout = "2006-01-02T15:04:05"
+
+// wallLayouts are the wall-clock forms accepted on input.
+var wallLayouts = []string{Layout, "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// ParseWallClock parses a date and time with no zone or offset. The result
+// is in UTC, which only holds its fields.
+func ParseWallClock(s string) (time.Time, error) {
+	for _, layout := range wallLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid wall-clock time %q", s)
+}
+
+// LoadZone loads an IANA time zone. Unlike time.LoadLocation it rejects the
+// empty name and "Local", which mean the server's zone.
+func LoadZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.New("time zone is required")
+	}
+	return time.LoadLocation(name)
+}
+
+// In returns the instant wall falls on in loc, under the zone's rules for
+// that date. A time skipped by a DST change is read with the offset in force
+// after it, so 02:30 on a night clocks jump from 02:00 to 03:00 lands on
+// 01:30 in the old offset. A time repeated when clocks fall back resolves to
+// its first occurrence.
+func In(wall time.Time, loc *time.Location) time.Time {
+	return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+}
+
+// Resolve returns the instant of a deadline stored as a wall-clock time in
+// Layout and the name of its zone. Skipped and repeated times resolve as In
+// describes.
+func Resolve(local, zone string) (time.Time, error) {
+	wall, err := ParseWallClock(local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := LoadZone(zone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return In(wall, loc), nil
+}
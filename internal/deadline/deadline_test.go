@@ -0,0 +1,64 @@
+package deadline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveAcrossDST(t *testing.T) {
+	loc, err := LoadZone("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		local string
+		want  string // UTC
+	}{
+		{"winter", "2026-01-15T09:00:00", "2026-01-15T14:00:00Z"},
+		{"summer", "2026-07-15T09:00:00", "2026-07-15T13:00:00Z"},
+		// 02:00–03:00 is skipped on 8 March; time.Date reads it with the
+		// offset in force after the change, EDT, landing on 01:30 EST
+		{"skipped", "2026-03-08T02:30:00", "2026-03-08T06:30:00Z"},
+		{"after skip", "2026-03-08T03:00:00", "2026-03-08T07:00:00Z"},
+		// 01:00–02:00 happens twice on 1 November; the first is taken
+		{"repeated", "2026-11-01T01:30:00", "2026-11-01T05:30:00Z"},
+		{"after repeat", "2026-11-01T02:00:00", "2026-11-01T07:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, _ := time.Parse(time.RFC3339, tt.want)
+
+			wall, err := ParseWallClock(tt.local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := In(wall, loc); !got.Equal(want) {
+				t.Errorf("In = %v, want %v", got.UTC(), want)
+			}
+
+			got, err := Resolve(tt.local, "America/New_York")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("Resolve = %v, want %v", got.UTC(), want)
+			}
+		})
+	}
+}
+
+func TestResolveRejects(t *testing.T) {
+	tests := []struct{ local, zone string }{
+		{"2026-01-15T09:00:00", ""},
+		{"2026-01-15T09:00:00", "Local"},
+		{"2026-01-15T09:00:00", "Mars/Olympus_Mons"},
+		{"2026-01-15T09:00:00Z", "UTC"},
+		{"tomorrow", "UTC"},
+	}
+	for _, tt := range tests {
+		if got, err := Resolve(tt.local, tt.zone); err == nil {
+			t.Errorf("Resolve(%q, %q) = %v, want an error", tt.local, tt.zone, got)
+		}
+	}
+}
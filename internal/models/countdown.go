@@ -18,6 +18,9 @@ type Countdown struct {
 	Name          string        `gorm:"not null;type:text" json:"name"`
 	Type          CountdownType `gorm:"not null;type:text;check:type IN ('fixed','on_send','on_open');index" json:"type"`
 	EndTime       *time.Time    `json:"end_time,omitempty"`
+	LocalEndTime  string        `gorm:"type:text" json:"local_end_time,omitempty"` // Wall-clock deadline in TimeZone, resolved again at render time
+	TimeZone      string        `gorm:"type:text" json:"time_zone,omitempty"`      // IANA zone of LocalEndTime
+	RecipientZone bool          `gorm:"default:false" json:"recipient_zone"`       // Read LocalEndTime in the recipient's ?tz= zone instead, when given
 	Duration      *int          `json:"duration,omitempty"`
 	StartedAt     *time.Time    `json:"started_at,omitempty"`
 	PreviewURL    string        `gorm:"type:text" json:"preview_url"`
@@ -37,7 +40,7 @@ type Template struct {
 	TextColor   string    `gorm:"not null;type:text" json:"text_color"`
 	Layout      string    `gorm:"not null;type:text" json:"layout"`
 	ShowUnits   bool      `gorm:"not null;default:1" json:"show_units"`
-	StyleConfig string    `gorm:"type:text" json:"style_config"` // Full JSON config for GIF generator
+	StyleConfig string    `gorm:"type:text" json:"style_config"` // gif.StyleConfig as JSON, versioned
 	CreatedAt   time.Time `json:"created_at"`
 
 	Countdown Countdown `gorm:"foreignKey:CountdownID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
@@ -45,8 +48,8 @@ type Template struct {
 
 type CountdownOpen struct {
 	ID            string    `gorm:"primaryKey;type:text" json:"id"`
-	CountdownID   string    `gorm:"not null;type:text;index" json:"countdown_id"`
-	RecipientUID  string    `gorm:"not null;type:text;uniqueIndex:idx_countdown_recipient" json:"recipient_uid"`
+	CountdownID   string    `gorm:"not null;type:text;uniqueIndex:idx_countdown_open_recipient" json:"countdown_id"`
+	RecipientUID  string    `gorm:"not null;type:text;uniqueIndex:idx_countdown_open_recipient" json:"recipient_uid"`
 	FirstOpenedAt time.Time `json:"first_opened_at"`
 
 	Countdown Countdown `gorm:"foreignKey:CountdownID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
@@ -61,3 +64,25 @@ type ColorPalette struct {
 	AccentColor    string    `gorm:"not null;type:text" json:"accent_color"`
 	CreatedAt      time.Time `json:"created_at"`
 }
+
+type Font struct {
+	ID         string    `gorm:"primaryKey;type:text" json:"id"`
+	UserID     string    `gorm:"not null;type:text;index" json:"user_id"`
+	Name       string    `gorm:"not null;type:text" json:"name"`
+	Format     string    `gorm:"not null;type:text;check:format IN ('ttf','otf')" json:"format"`
+	SizeBytes  int       `gorm:"not null" json:"size_bytes"`
+	StorageKey string    `gorm:"not null;type:text" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type BackgroundImage struct {
+	ID         string    `gorm:"primaryKey;type:text" json:"id"`
+	UserID     string    `gorm:"not null;type:text;index" json:"user_id"`
+	Name       string    `gorm:"not null;type:text" json:"name"`
+	Format     string    `gorm:"not null;type:text;check:format IN ('png','jpeg')" json:"format"`
+	Width      int       `gorm:"not null" json:"width"`
+	Height     int       `gorm:"not null" json:"height"`
+	SizeBytes  int       `gorm:"not null" json:"size_bytes"`
+	StorageKey string    `gorm:"not null;type:text" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
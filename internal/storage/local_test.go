@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestStore(t *testing.T) (*LocalStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	store, err := NewLocalStore(root, "http://localhost:8080/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func TestLocalStorePutGetDelete(t *testing.T) {
+	store, _ := newTestStore(t)
+	key := "fonts/user-1/font.ttf"
+
+	if err := store.Put(key, []byte("data"), "font/ttf"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(key)
+	if err != nil || string(got) != "data" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+	if url := store.URL(key); url != "http://localhost:8080/static/fonts/user-1/font.ttf" {
+		t.Errorf("URL = %q", url)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	// Deleting what is already gone is not an error
+	if err := store.Delete(key); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+}
+
+func TestLocalStoreKeysStayUnderRoot(t *testing.T) {
+	store, dir := newTestStore(t)
+	outside := filepath.Join(dir, "outside.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../outside.txt", "a/../../outside.txt", "/../../outside.txt"} {
+		if data, err := store.Get(key); err == nil {
+			t.Errorf("Get(%q) read %q from outside the root", key, data)
+		}
+		if err := store.Put(key, []byte("overwritten"), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(outside); string(data) != "secret" {
+		t.Errorf("file outside the root was changed to %q", data)
+	}
+
+	for _, key := range []string{"", "/", ".."} {
+		if err := store.Put(key, []byte("x"), "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+}
+
+func TestLocalStoreHandlerDoesNotListDirectories(t *testing.T) {
+	store, _ := newTestStore(t)
+	if err := store.Put("previews/user-1/a.gif", []byte("GIF89a"), "image/gif"); err != nil {
+		t.Fatal(err)
+	}
+	h := store.Handler()
+
+	for path, want := range map[string]int{
+		"/static/previews/user-1/a.gif": http.StatusOK,
+		"/static/previews/user-1/b.gif": http.StatusNotFound,
+		"/static/":                      http.StatusNotFound,
+		"/static/previews/":             http.StatusNotFound,
+		"/static/previews/user-1/":      http.StatusNotFound,
+		"/static/previews":              http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("GET %s: status %d, want %d", path, w.Code, want)
+		}
+	}
+}
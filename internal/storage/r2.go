@@ -2,19 +2,23 @@ package storage
 
 import (
 	"bytes"
+	"io"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 type R2Client struct {
-	client *s3.S3
-	bucket string
+	client    *s3.S3
+	bucket    string
+	publicURL string
 }
 
-func NewR2Client(endpoint, accessKeyID, secretAccessKey, bucketName string) (*R2Client, error) {
+func NewR2Client(endpoint, accessKeyID, secretAccessKey, bucketName, publicURL string) (*R2Client, error) {
 	sess, err := session.NewSession(&aws.Config{
 		Region:      aws.String("auto"),
 		Endpoint:    aws.String(endpoint),
@@ -25,25 +29,46 @@ func NewR2Client(endpoint, accessKeyID, secretAccessKey, bucketName string) (*R2
 	}
 
 	return &R2Client{
-		client: s3.New(sess),
-		bucket: bucketName,
+		client:    s3.New(sess),
+		bucket:    bucketName,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
 	}, nil
 }
 
-func (r *R2Client) UploadGIF(key string, data []byte) error {
+func (r *R2Client) Put(key string, data []byte, contentType string) error {
 	_, err := r.client.PutObject(&s3.PutObjectInput{
 		Bucket:      aws.String(r.bucket),
 		Key:         aws.String(key),
 		Body:        bytes.NewReader(data),
-		ContentType: aws.String("image/gif"),
+		ContentType: aws.String(contentType),
 	})
 	return err
 }
 
-func (r *R2Client) DeleteObject(key string) error {
+func (r *R2Client) Get(key string) ([]byte, error) {
+	out, err := r.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	return io.ReadAll(out.Body)
+}
+
+func (r *R2Client) Delete(key string) error {
 	_, err := r.client.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: aws.String(r.bucket),
 		Key:    aws.String(key),
 	})
 	return err
 }
+
+func (r *R2Client) URL(key string) string {
+	return r.publicURL + "/" + key
+}
@@ -0,0 +1,15 @@
+package storage
+
+import "errors"
+
+// ErrNotFound is returned by Get when no object exists under the key.
+var ErrNotFound = errors.New("object not found")
+
+// Store is the object storage used for rendered previews and uploads.
+type Store interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	// URL returns the public URL the object is served from.
+	URL(key string) string
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"gif-service/gif"
 	"gif-service/handlers/private"
+	"gif-service/handlers/public"
 	"gif-service/internal/database"
 	"gif-service/internal/storage"
 	"gif-service/routes"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -26,27 +30,106 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(Response{Message: "OK"})
 }
 
+// newStore picks the object storage backend from STORAGE_DRIVER ("r2" or
+// "local"). When unset, R2 is used if a bucket is configured.
+func newStore() (storage.Store, error) {
+	driver := os.Getenv("STORAGE_DRIVER")
+	if driver == "" {
+		driver = "local"
+		if os.Getenv("R2_BUCKET_NAME") != "" {
+			driver = "r2"
+		}
+	}
+
+	switch driver {
+	case "r2":
+		return storage.NewR2Client(
+			os.Getenv("R2_BUCKET_ENDPOINT"),
+			os.Getenv("R2_BUCKET_ACCESS_KEY_ID"),
+			os.Getenv("R2_BUCKET_SECRET_ACCESS_KEY"),
+			os.Getenv("R2_BUCKET_NAME"),
+			os.Getenv("R2_PUBLIC_URL"),
+		)
+	case "local":
+		dir := os.Getenv("LOCAL_STORAGE_DIR")
+		if dir == "" {
+			dir = "./data/storage"
+		}
+		baseURL := os.Getenv("PUBLIC_BASE_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		return storage.NewLocalStore(dir, baseURL)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
+// spriteCacheLimits reads SPRITE_CACHE_MAX_ENTRIES, SPRITE_CACHE_MAX_BYTES
+// and SPRITE_CACHE_TTL (e.g. "30m"), keeping the defaults for any unset.
+func spriteCacheLimits() (gif.SpriteCacheLimits, error) {
+	limits := gif.DefaultSpriteCacheLimits
+	if v := os.Getenv("SPRITE_CACHE_MAX_ENTRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return limits, fmt.Errorf("SPRITE_CACHE_MAX_ENTRIES: %w", err)
+		}
+		limits.MaxEntries = n
+	}
+	if v := os.Getenv("SPRITE_CACHE_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return limits, fmt.Errorf("SPRITE_CACHE_MAX_BYTES: %w", err)
+		}
+		limits.MaxBytes = n
+	}
+	if v := os.Getenv("SPRITE_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return limits, fmt.Errorf("SPRITE_CACHE_TTL: %w", err)
+		}
+		limits.TTL = d
+	}
+	return limits, nil
+}
+
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
 
+	if err := gif.LoadFonts("fonts"); err != nil {
+		log.Fatal(err)
+	}
+
 	db, err := database.New("./data/timerio.db")
 	if err != nil {
 		log.Fatal(err)
 	}
 	private.SetDB(db.DB)
+	public.SetDB(db.DB)
 
-	r2Client, err := storage.NewR2Client(
-		os.Getenv("R2_BUCKET_ENDPOINT"),
-		os.Getenv("R2_BUCKET_ACCESS_KEY_ID"),
-		os.Getenv("R2_BUCKET_SECRET_ACCESS_KEY"),
-		os.Getenv("R2_BUCKET_NAME"),
-	)
+	store, err := newStore()
 	if err != nil {
-		log.Fatal("Failed to initialize R2 client:", err)
+		log.Fatal("Failed to initialize storage:", err)
+	}
+	private.SetStore(store)
+	gif.SetFontLoader(private.LoadFont)
+	gif.SetImageLoader(private.LoadBackground)
+
+	limits, err := spriteCacheLimits()
+	if err != nil {
+		log.Fatal("Invalid sprite cache limits:", err)
+	}
+	gif.SetSpriteCacheLimits(limits)
+
+	if v := os.Getenv("IMAGE_CACHE_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Fatal("Invalid IMAGE_CACHE_MAX_BYTES:", err)
+		}
+		gif.SetImageCacheBytes(n)
 	}
-	private.SetR2Client(r2Client)
 
 	r := chi.NewRouter()
 
@@ -60,6 +143,9 @@ func main() {
 	r.Use(middleware.Logger)
 
 	r.Get("/health", healthHandler)
+	if local, ok := store.(*storage.LocalStore); ok {
+		r.Handle("/static/*", local.Handler())
+	}
 	routes.Setup(r)
 
 	port := ":8080"
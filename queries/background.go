@@ -0,0 +1,53 @@
+package queries
+
+import (
+	"fmt"
+	"gif-service/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func CreateBackgroundImage(db *gorm.DB, userID, name, format string, width, height, sizeBytes int) (*models.BackgroundImage, error) {
+	id := uuid.New().String()
+	image := &models.BackgroundImage{
+		ID:         id,
+		UserID:     userID,
+		Name:       name,
+		Format:     format,
+		Width:      width,
+		Height:     height,
+		SizeBytes:  sizeBytes,
+		StorageKey: fmt.Sprintf("backgrounds/%s/%s.%s", userID, id, format),
+		CreatedAt:  time.Now(),
+	}
+
+	if err := db.Create(image).Error; err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// GetBackgroundImageById looks an image up without owner scoping, for
+// render time.
+func GetBackgroundImageById(db *gorm.DB, id string) (*models.BackgroundImage, error) {
+	return getUpload[models.BackgroundImage](db, id)
+}
+
+func GetUserBackgroundImage(db *gorm.DB, id, userID string) (*models.BackgroundImage, error) {
+	return getUserUpload[models.BackgroundImage](db, id, userID)
+}
+
+func ListBackgroundImages(db *gorm.DB, userID string) ([]models.BackgroundImage, error) {
+	return listUploads[models.BackgroundImage](db, userID)
+}
+
+func DeleteBackgroundImage(db *gorm.DB, id, userID string) error {
+	return deleteUpload[models.BackgroundImage](db, id, userID)
+}
+
+func CountBackgroundImages(db *gorm.DB, userID string) (int64, error) {
+	return countUploads[models.BackgroundImage](db, userID)
+}
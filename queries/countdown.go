@@ -24,22 +24,19 @@ func CreateCountdown(db *gorm.DB, userId string, name string) (*models.Countdown
 	return countdown, nil
 }
 
-func CreateCountdownFull(db *gorm.DB, userId string, name string, countdownType models.CountdownType, endTime *time.Time, duration *int) (*models.Countdown, error) {
-	countdown := &models.Countdown{
-		ID:        uuid.New().String(),
-		UserID:    userId,
-		Name:      name,
-		Type:      countdownType,
-		EndTime:   endTime,
-		Duration:  duration,
-		CreatedAt: time.Now(),
-	}
-
-	if err := db.Create(countdown).Error; err != nil {
+// CreateCountdownFull creates a countdown with its timer, taken from
+// countdown's type, deadline and duration fields. The ID, owner and creation
+// time are set here.
+func CreateCountdownFull(db *gorm.DB, userId string, countdown models.Countdown) (*models.Countdown, error) {
+	countdown.ID = uuid.New().String()
+	countdown.UserID = userId
+	countdown.CreatedAt = time.Now()
+
+	if err := db.Create(&countdown).Error; err != nil {
 		return nil, err
 	}
 
-	return countdown, nil
+	return &countdown, nil
 }
 
 func GetCountdownById(db *gorm.DB, id string) (*models.Countdown, error) {
@@ -52,6 +49,16 @@ func GetCountdownById(db *gorm.DB, id string) (*models.Countdown, error) {
 	return &countdown, nil
 }
 
+func GetUserCountdownById(db *gorm.DB, id, userID string) (*models.Countdown, error) {
+	var countdown models.Countdown
+
+	if err := db.First(&countdown, "id = ? AND user_id = ? AND is_soft_deleted = ?", id, userID, false).Error; err != nil {
+		return nil, err
+	}
+
+	return &countdown, nil
+}
+
 func ListCountdowns(db *gorm.DB, userID string, filters map[string]interface{}) ([]models.Countdown, error) {
 	var countdowns []models.Countdown
 
@@ -62,8 +69,8 @@ func ListCountdowns(db *gorm.DB, userID string, filters map[string]interface{})
 	return countdowns, nil
 }
 
-func DeleteCountdown(db *gorm.DB, id string) error {
-	result := db.Where("id = ?", id).Delete(&models.Countdown{})
+func DeleteCountdown(db *gorm.DB, id, userID string) error {
+	result := db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Countdown{})
 
 	if result.Error != nil {
 		return result.Error
@@ -76,11 +83,11 @@ func DeleteCountdown(db *gorm.DB, id string) error {
 	return nil
 }
 
-func StartCountdown(db *gorm.DB, id string) error {
+func StartCountdown(db *gorm.DB, id, userID string) error {
 	now := time.Now()
 
 	result := db.Model(&models.Countdown{}).
-		Where("id = ? AND type = ? AND is_soft_deleted = ?", id, models.CountdownTypeBirthday, false).
+		Where("id = ? AND user_id = ? AND type = ? AND is_soft_deleted = ?", id, userID, models.CountdownTypeBirthday, false).
 		Update("started_at", now)
 
 	if result.Error != nil {
@@ -94,8 +101,8 @@ func StartCountdown(db *gorm.DB, id string) error {
 	return nil
 }
 
-func UpdateCountdown(db *gorm.DB, id string, updates map[string]interface{}) error {
-	result := db.Model(&models.Countdown{}).Where("id = ?", id).Updates(updates)
+func UpdateCountdown(db *gorm.DB, id, userID string, updates map[string]interface{}) error {
+	result := db.Model(&models.Countdown{}).Where("id = ? AND user_id = ?", id, userID).Updates(updates)
 
 	if result.Error != nil {
 		return result.Error
@@ -107,3 +114,8 @@ func UpdateCountdown(db *gorm.DB, id string, updates map[string]interface{}) err
 
 	return nil
 }
+
+func IncrementCountdownViews(db *gorm.DB, id string) error {
+	return db.Model(&models.Countdown{}).Where("id = ?", id).
+		UpdateColumn("views", gorm.Expr("views + ?", 1)).Error
+}
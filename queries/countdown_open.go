@@ -0,0 +1,34 @@
+package queries
+
+import (
+	"gif-service/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecordCountdownOpen returns the recipient's open record for the countdown,
+// creating it with FirstOpenedAt = openedAt on the first open. Concurrent
+// first opens are safe: the unique (countdown_id, recipient_uid) index keeps
+// the earliest insert and later ones read it back.
+func RecordCountdownOpen(db *gorm.DB, countdownID, recipientUID string, openedAt time.Time) (*models.CountdownOpen, error) {
+	open := &models.CountdownOpen{
+		ID:            uuid.New().String(),
+		CountdownID:   countdownID,
+		RecipientUID:  recipientUID,
+		FirstOpenedAt: openedAt,
+	}
+
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(open).Error; err != nil {
+		return nil, err
+	}
+
+	var existing models.CountdownOpen
+	if err := db.Where("countdown_id = ? AND recipient_uid = ?", countdownID, recipientUID).First(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	return &existing, nil
+}
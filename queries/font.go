@@ -0,0 +1,50 @@
+package queries
+
+import (
+	"fmt"
+	"gif-service/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func CreateFont(db *gorm.DB, userID, name, format string, sizeBytes int) (*models.Font, error) {
+	id := uuid.New().String()
+	font := &models.Font{
+		ID:         id,
+		UserID:     userID,
+		Name:       name,
+		Format:     format,
+		SizeBytes:  sizeBytes,
+		StorageKey: fmt.Sprintf("fonts/%s/%s.%s", userID, id, format),
+		CreatedAt:  time.Now(),
+	}
+
+	if err := db.Create(font).Error; err != nil {
+		return nil, err
+	}
+
+	return font, nil
+}
+
+// GetFontById looks a font up without owner scoping, for render time.
+func GetFontById(db *gorm.DB, id string) (*models.Font, error) {
+	return getUpload[models.Font](db, id)
+}
+
+func GetUserFont(db *gorm.DB, id, userID string) (*models.Font, error) {
+	return getUserUpload[models.Font](db, id, userID)
+}
+
+func ListFonts(db *gorm.DB, userID string) ([]models.Font, error) {
+	return listUploads[models.Font](db, userID)
+}
+
+func DeleteFont(db *gorm.DB, id, userID string) error {
+	return deleteUpload[models.Font](db, id, userID)
+}
+
+func CountFonts(db *gorm.DB, userID string) (int64, error) {
+	return countUploads[models.Font](db, userID)
+}
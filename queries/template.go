@@ -63,8 +63,21 @@ func GetTemplate(db *gorm.DB, countdownID string) (*models.Template, error) {
 	return &template, nil
 }
 
-func UpdateTemplate(db *gorm.DB, id string, updates *models.Template) error {
-	result := db.Model(&models.Template{}).Where("id = ?", id).Updates(updates)
+func GetUserTemplate(db *gorm.DB, countdownID, userID string) (*models.Template, error) {
+	var template models.Template
+
+	if err := db.Where("countdown_id = ? AND countdown_id IN (?)", countdownID, ownedCountdownIDs(db, userID)).
+		First(&template).Error; err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+func UpdateTemplate(db *gorm.DB, id, userID string, updates *models.Template) error {
+	result := db.Model(&models.Template{}).
+		Where("id = ? AND countdown_id IN (?)", id, ownedCountdownIDs(db, userID)).
+		Updates(updates)
 
 	if result.Error != nil {
 		return result.Error
@@ -76,3 +89,10 @@ func UpdateTemplate(db *gorm.DB, id string, updates *models.Template) error {
 
 	return nil
 }
+
+// ownedCountdownIDs is a subquery selecting the IDs of the user's countdowns,
+// used to scope template access through the owning countdown.
+func ownedCountdownIDs(db *gorm.DB, userID string) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).
+		Model(&models.Countdown{}).Select("id").Where("user_id = ?", userID)
+}
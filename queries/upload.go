@@ -0,0 +1,62 @@
+package queries
+
+import (
+	"gorm.io/gorm"
+)
+
+// Uploads (fonts and background images) are looked up, listed, counted and
+// deleted the same way, scoped to their owner except at render time.
+
+func getUpload[T any](db *gorm.DB, id string) (*T, error) {
+	var upload T
+
+	if err := db.First(&upload, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+func getUserUpload[T any](db *gorm.DB, id, userID string) (*T, error) {
+	var upload T
+
+	if err := db.First(&upload, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+func listUploads[T any](db *gorm.DB, userID string) ([]T, error) {
+	var uploads []T
+
+	if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
+
+func deleteUpload[T any](db *gorm.DB, id, userID string) error {
+	result := db.Where("id = ? AND user_id = ?", id, userID).Delete(new(T))
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func countUploads[T any](db *gorm.DB, userID string) (int64, error) {
+	var count int64
+
+	if err := db.Model(new(T)).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
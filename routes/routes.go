@@ -10,6 +10,7 @@ import (
 
 func Setup(r *chi.Mux) {
 	r.Post("/generate", public.Generate)
+	r.Get("/c/{id}.gif", public.RenderCountdown)
 
 	r.Route("/api", func(r chi.Router) {
 		r.Use(middleware.Auth)
@@ -20,6 +21,7 @@ func Setup(r *chi.Mux) {
 		r.Get("/countdowns/{id}", private.GetCountdown)
 		r.Patch("/countdowns/{id}", private.UpdateCountdown)
 		r.Put("/countdowns/{id}/save", private.SaveExistingCountdown)
+		r.Post("/countdowns/{id}/start", private.StartCountdown)
 		r.Delete("/countdowns/{id}", private.DeleteCountdown)
 
 		// Preview
@@ -34,5 +36,19 @@ func Setup(r *chi.Mux) {
 		r.Post("/palettes", private.CreatePalette)
 		r.Put("/palettes/{id}", private.UpdatePalette)
 		r.Delete("/palettes/{id}", private.DeletePalette)
+
+		// Font routes
+		r.Get("/fonts", private.ListFonts)
+		r.Post("/fonts", private.UploadFont)
+		r.Delete("/fonts/{id}", private.DeleteFont)
+
+		// Background image routes
+		r.Get("/backgrounds", private.ListBackgrounds)
+		r.Post("/backgrounds", private.UploadBackground)
+		r.Delete("/backgrounds/{id}", private.DeleteBackground)
+
+		// Cache stats, which describe every tenant's renders
+		r.Get("/stats/render-cache", public.RenderCacheStats)
+		r.Get("/stats/sprite-cache", public.SpriteCacheStats)
 	})
 }